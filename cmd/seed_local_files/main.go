@@ -40,14 +40,8 @@ func main() {
 			rec := core.NewRecord(remoteColl)
 			rec.Set("name", remoteName)
 			rec.Set("type", "local") // Rclone type
-			// Local config usually just needs keys, but for my custom logic in main.go, I support "root" in config
-			// main.go: handled "root" key specially.
-			// However, standard Rclone "local" backend doesn't use "root" key in connection string the same way...
-			// Wait, main.go logic:
-			// 	if v, ok := configMap["root"]; ok { rootPath = ... }
-			//  connStr := ... + ":" + rootPath
-			// For local, config is usually empty, and root is the path.
-			// So yes, my main.go 'root' logic supports this abstraction perfectly.
+			// The local backend needs no config; "root" scopes the remote to the sample data
+			// (the config key works on databases that predate the root field)
 			rec.Set("config", map[string]interface{}{
 				"root": sampleDataDir,
 			})
@@ -0,0 +1,584 @@
+package flight
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/darianmavgo/mksqlite/converters"
+	"github.com/darianmavgo/mksqlite/converters/common"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/vfs"
+)
+
+// ErrArchiveEntryNotFound is returned when a path continues past an archive to an entry
+// the archive does not contain
+var ErrArchiveEntryNotFound = errors.New("archive entry not found")
+
+// archiveExts are the names of archives whose entries can be addressed: zip, and tar plain
+// or compressed
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tar.zst", ".tar.xz"}
+
+// archiveListingTable is the table the zip and tar drivers list archive entries in
+const archiveListingTable = "file_list"
+
+func init() {
+	converters.Register("tar", &tarDriver{})
+}
+
+// isArchiveName reports whether a file name is that of an archive whose entries can be
+// addressed by continuing the path past it
+func isArchiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitArchivePath splits a dataset path that continues past an archive into the archive
+// and the entry inside it: "/bundle.tar.gz/2026/sales.csv" becomes "/bundle.tar.gz" and
+// "2026/sales.csv". Paths without an entry are returned unchanged with an empty entry.
+func SplitArchivePath(datasetPath string) (archivePath, entryPath string) {
+	parts := strings.Split(datasetPath, "/")
+	for i, part := range parts[:len(parts)-1] {
+		if !isArchiveName(part) {
+			continue
+		}
+		entry := strings.Trim(strings.Join(parts[i+1:], "/"), "/")
+		if entry == "" {
+			break
+		}
+		return strings.Join(parts[:i+1], "/"), entry
+	}
+	return datasetPath, ""
+}
+
+// ExpandArchivePath moves a zip member addressed after the archive from the column path into
+// the dataset path. Banquet ends the dataset at the first ".zip" segment, so for
+// "/archive.zip/inner/sales.xlsx/Sheet1" it yields DataSetPath "/archive.zip" and ColumnPath
+// "inner/sales.xlsx/Sheet1"; afterwards DataSetPath is "/archive.zip/inner/sales.xlsx"
+// and ColumnPath "Sheet1". The member runs up to the first segment with an extension; the
+// archive's own listing table and column selectors are left alone. This is only a guess from
+// the path, ResolveArchiveMember settles it once the archive can be listed.
+func ExpandArchivePath(b *banquet.Banquet) {
+	if strings.ToLower(path.Ext(b.DataSetPath)) != ".zip" || b.ColumnPath == "" {
+		return
+	}
+
+	segments := strings.Split(strings.Trim(b.ColumnPath, "/"), "/")
+	if segments[0] == archiveListingTable {
+		return
+	}
+
+	var member []string
+	for _, segment := range segments {
+		if segment == "" || isSelectorSegment(segment) {
+			break
+		}
+		member = append(member, segment)
+		if path.Ext(segment) != "" {
+			break
+		}
+	}
+	if len(member) == 0 {
+		return
+	}
+
+	rest := segments[len(member):]
+	b.DataSetPath = strings.TrimSuffix(b.DataSetPath, "/") + "/" + strings.Join(member, "/")
+	b.ColumnPath = strings.Join(rest, "/")
+	b.Table = ""
+	if len(rest) > 0 && !isSelectorSegment(rest[0]) {
+		b.Table = rest[0]
+	}
+}
+
+// ResolveArchiveMember re-splits a path expanded by ExpandArchivePath against the members of
+// the zip at archiveFile, so folders with dots in their names ("v1.2/data.csv") and tables
+// after a folder ("reports/tb0") are not mistaken for files. The member is the first file
+// the path names; a folder is followed by nothing or its tb0 listing, which becomes the
+// table.
+func ResolveArchiveMember(b *banquet.Banquet, archiveFile string) error {
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+	if entryPath == "" || strings.ToLower(path.Ext(archivePath)) != ".zip" {
+		return nil
+	}
+
+	entries, err := listArchive(archiveFile)
+	if err != nil {
+		return fmt.Errorf("failed to list archive %s: %w", archivePath, err)
+	}
+	files, dirs := map[string]bool{}, map[string]bool{}
+	for _, e := range entries {
+		name := e.Name
+		if e.IsDir {
+			dirs[name] = true
+		} else {
+			files[name] = true
+		}
+		// Folders may only exist as the prefix of their members
+		for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name[:i], "/") {
+			dirs[name[:i]] = true
+		}
+	}
+
+	segments := strings.Split(entryPath, "/")
+	if column := strings.Trim(b.ColumnPath, "/"); column != "" {
+		segments = append(segments, strings.Split(column, "/")...)
+	}
+
+	file, dir := 0, 0
+	for i := range segments {
+		name := strings.Join(segments[:i+1], "/")
+		if files[name] {
+			file = i + 1
+			break
+		}
+		if !dirs[name] {
+			break
+		}
+		dir = i + 1
+	}
+
+	member, table := file, ""
+	switch {
+	case file > 0:
+		if rest := segments[file:]; len(rest) > 0 && !isSelectorSegment(rest[0]) {
+			table = rest[0]
+		}
+	case dir > 0 && (dir == len(segments) || segments[dir] == "tb0" || isSelectorSegment(segments[dir])):
+		// Folders are indexed like directories
+		member, table = dir, "tb0"
+	default:
+		// Not in the archive: all of it is the member, so the build reports it as not found
+		for member < len(segments) && !isSelectorSegment(segments[member]) {
+			member++
+		}
+	}
+
+	b.DataSetPath = archivePath + "/" + strings.Join(segments[:member], "/")
+	b.ColumnPath = strings.Join(segments[member:], "/")
+	b.Table = table
+	return nil
+}
+
+// resolveRemoteArchiveMember resolves the zip member of a remote dataset path (see
+// ResolveArchiveMember). Archives of local remotes are listed in place, others are fetched
+// into pb_data/cache/archives, where their members' builds find them again.
+func resolveRemoteArchiveMember(app core.App, rm *RcloneManager, v *vfs.VFS, remoteRecord *core.Record, b *banquet.Banquet) error {
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+	if entryPath == "" || strings.ToLower(path.Ext(archivePath)) != ".zip" {
+		return nil
+	}
+	if localPath, ok := rm.LocalPath(v, archivePath); ok {
+		return ResolveArchiveMember(b, localPath)
+	}
+
+	archiveKey := archiveCacheKey(b, archivePath)
+	archiveFile := archiveFilePath(app, archiveKey, archivePath)
+	if !cacheExists(archiveFile) {
+		node, err := rm.Stat(v, archivePath)
+		if err != nil || node.IsDir() {
+			// Reported by the build
+			return nil
+		}
+		fetchPath := archivePath
+		if query := FetchQuery(b); query != "" {
+			fetchPath += "?" + query
+		}
+		rb := &remoteBuild{
+			App:          app,
+			Rclone:       rm,
+			VFS:          v,
+			RemoteRecord: remoteRecord,
+			DataSetPath:  b.DataSetPath,
+			ArchiveKey:   archiveKey,
+			FetchPath:    fetchPath,
+		}
+		fetched, release, err := rb.fetchArchive(node)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return ResolveArchiveMember(b, fetched)
+	}
+
+	release := AcquireCache(archiveFile)
+	defer release()
+	return ResolveArchiveMember(b, archiveFile)
+}
+
+// isSelectorSegment reports whether a path segment selects columns, sorts or filters
+// (the indicators banquet uses) rather than naming a file or table
+func isSelectorSegment(segment string) bool {
+	return strings.ContainsAny(segment, ",=<>!") ||
+		strings.HasPrefix(segment, banquet.ASC) ||
+		strings.HasPrefix(segment, banquet.DESC) ||
+		(strings.HasPrefix(segment, "[") && strings.Contains(segment, ":"))
+}
+
+// archiveEntry is one member of a zip or tar archive
+type archiveEntry struct {
+	Name     string // cleaned, see cleanEntryName
+	Modified time.Time
+	Size     int64
+	IsDir    bool
+}
+
+// isZipSample reports whether content starts like a zip archive
+func isZipSample(sample []byte) bool {
+	return bytes.HasPrefix(sample, magicZip) || bytes.HasPrefix(sample, magicZipEnd)
+}
+
+// listArchive returns the members of a local zip or tar (maybe compressed) archive file
+func listArchive(archivePath string) ([]archiveEntry, error) {
+	src, err := openSource(archivePath, "")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var entries []archiveEntry
+	if src.compression == "" && isZipSample(src.sample) {
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			entries = append(entries, archiveEntry{
+				Name:     cleanEntryName(f.Name),
+				Modified: f.Modified,
+				Size:     int64(f.UncompressedSize64),
+				IsDir:    f.FileInfo().IsDir(),
+			})
+		}
+		return entries, nil
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		entries = append(entries, archiveEntry{
+			Name:     cleanEntryName(header.Name),
+			Modified: header.ModTime,
+			Size:     header.Size,
+			IsDir:    header.Typeflag == tar.TypeDir,
+		})
+	}
+}
+
+// extractArchiveEntry writes one file of a local zip or tar (maybe compressed) archive to destPath
+func extractArchiveEntry(archivePath, entryPath, destPath string) error {
+	src, err := openSource(archivePath, "")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	want := cleanEntryName(entryPath)
+	write := func(name string, size int64, r io.Reader) error {
+		log.Printf("[CONVERTER] Extracting %s (%d bytes) from archive", name, size)
+		out, err := os.Create(destPath)
+		if err != nil {
+			return fmt.Errorf("failed to create extracted file: %w", err)
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to extract %s: %w", entryPath, err)
+		}
+		return out.Close()
+	}
+
+	if src.compression == "" && isZipSample(src.sample) {
+		r, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() || cleanEntryName(f.Name) != want {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", entryPath, err)
+			}
+			defer rc.Close()
+			return write(f.Name, int64(f.UncompressedSize64), rc)
+		}
+		return fmt.Errorf("%w: %s", ErrArchiveEntryNotFound, entryPath)
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%w: %s", ErrArchiveEntryNotFound, entryPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !header.FileInfo().Mode().IsRegular() || cleanEntryName(header.Name) != want {
+			continue
+		}
+		return write(header.Name, header.Size, tr)
+	}
+}
+
+// extractEntryToTemp extracts an archive entry into pb_data/temp for conversion, keeping the
+// entry's extension. The caller removes the returned file.
+func extractEntryToTemp(app core.App, archivePath, entryPath, cacheKey string) (string, error) {
+	tempDir := filepath.Join(app.DataDir(), "temp")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	entryFile := filepath.Join(tempDir, cacheKey+"-entry"+sourceExt(entryPath))
+	if err := extractArchiveEntry(archivePath, entryPath, entryFile); err != nil {
+		os.Remove(entryFile)
+		return "", err
+	}
+	return entryFile, nil
+}
+
+// convertArchiveEntry builds the cache for an entry of a local archive file: a file is
+// extracted and converted like any dataset, a directory is indexed into tb0 like a remote
+// folder so users can navigate inside the archive. datasetPath is the full path of the
+// entry (archive included) and fills the listing's path column.
+func convertArchiveEntry(app core.App, archivePath, entryPath, datasetPath, cacheKey, cachePath string, convert *ConvertOptions) (*ConvertResult, error) {
+	entryFile, err := extractEntryToTemp(app, archivePath, entryPath, cacheKey)
+	if errors.Is(err, ErrArchiveEntryNotFound) {
+		if err := indexArchiveDirectory(archivePath, entryPath, datasetPath, cachePath); err != nil {
+			return nil, err
+		}
+		return &ConvertResult{Driver: "index"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(entryFile)
+
+	return ConvertSource(entryFile, cachePath, convert)
+}
+
+// indexArchiveDirectory writes the direct children of a directory inside an archive to a
+// tb0 table with the columns of IndexDirectory. Directories that only exist implicitly (as
+// the prefix of member names) are listed too. Returns ErrArchiveEntryNotFound when
+// nothing in the archive lives below dirPath.
+func indexArchiveDirectory(archivePath, dirPath, datasetPath, cachePath string) error {
+	entries, err := listArchive(archivePath)
+	if err != nil {
+		return err
+	}
+
+	prefix := cleanEntryName(dirPath) + "/"
+	children := map[string]archiveEntry{}
+	for _, e := range entries {
+		rest := strings.TrimPrefix(e.Name, prefix)
+		if rest == e.Name || rest == "" {
+			continue
+		}
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			if _, seen := children[name]; !seen {
+				children[name] = archiveEntry{Name: name, Modified: e.Modified, IsDir: true}
+			}
+			continue
+		}
+		e.Name = rest
+		children[rest] = e
+	}
+	if len(children) == 0 {
+		return fmt.Errorf("%w: %s", ErrArchiveEntryNotFound, dirPath)
+	}
+
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	log.Printf("[CONVERTER] Indexing %s inside archive (%d entries)", dirPath, len(names))
+	return publishAtomically(cachePath, func(tmpPath string) error {
+		db, err := sql.Open("sqlite", tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to open cache database: %w", err)
+		}
+		defer db.Close()
+
+		// Same table and columns as IndexDirectory
+		_, err = db.Exec(listingTableSQL)
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.Prepare("INSERT INTO tb0 (path, name, size, extension, mod_time, is_dir) VALUES (?, ?, ?, ?, ?, ?)")
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, name := range names {
+			e := children[name]
+			size, isDir := e.Size, 0
+			if e.IsDir {
+				size, isDir = 0, 1
+			}
+			_, err := stmt.Exec(path.Join(datasetPath, name), name, size, path.Ext(name), e.Modified.Format(time.RFC3339), isDir)
+			if err != nil {
+				return fmt.Errorf("failed to index entry %s: %w", name, err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// cleanEntryName normalises archive member names ("./2026/sales.csv", "/2026/sales.csv")
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// archiveCacheKey is the cache key of the archive a dataset path continues past. It equals the
+// key of the archive's own listing and names the downloaded archive in pb_data/cache/archives.
+func archiveCacheKey(b *banquet.Banquet, archivePath string) string {
+	archive := *b
+	archive.DataSetPath = archivePath
+	return GenCacheKey(&archive)
+}
+
+// archiveFilePath is where a remote archive is downloaded to in pb_data/cache/archives
+func archiveFilePath(app core.App, archiveKey, archivePath string) string {
+	return filepath.Join(app.DataDir(), "cache", "archives", archiveKey+sourceExt(archivePath))
+}
+
+// fetchArchive downloads a remote archive into pb_data/cache/archives once and reuses it for
+// every entry until the source changes; archives of local remotes are read in place. The
+// returned function releases the archive's lease.
+func (rb *remoteBuild) fetchArchive(node vfs.Node) (string, func(), error) {
+	archivePath, _ := SplitArchivePath(rb.DataSetPath)
+	if localPath, ok := rb.Rclone.LocalPath(rb.VFS, archivePath); ok {
+		return localPath, func() {}, nil
+	}
+
+	archiveFile := archiveFilePath(rb.App, rb.ArchiveKey, archivePath)
+	archiveDir := filepath.Dir(archiveFile)
+	release := AcquireCache(archiveFile)
+
+	fingerprint := NodeFingerprint(node)
+	_, err := cacheBuilds.Do("archive:"+rb.ArchiveKey, cacheBuildWait, func() error {
+		if SourceUnchanged(archiveFile, fingerprint) {
+			// Keeps the janitor's least recently used order in step with use
+			return RenewCache(archiveFile)
+		}
+
+		if err := os.MkdirAll(archiveDir, 0755); err != nil {
+			return fmt.Errorf("failed to create archive cache directory: %w", err)
+		}
+		log.Printf("[BANQUET] Fetching archive %s", archivePath)
+		tmpFile := archiveFile + ".download"
+		if _, err := rb.Rclone.FetchFile(rb.VFS, rb.FetchPath, tmpFile); err != nil {
+			os.Remove(tmpFile)
+			return fmt.Errorf("failed to fetch archive %s: %w", archivePath, err)
+		}
+		if err := os.Rename(tmpFile, archiveFile); err != nil {
+			os.Remove(tmpFile)
+			return fmt.Errorf("failed to store archive: %w", err)
+		}
+		return WriteFingerprint(archiveFile, fingerprint)
+	})
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	return archiveFile, release, nil
+}
+
+// tarDriver lists the entries of a tar archive in a file_list table, like the zip driver
+type tarDriver struct{}
+
+// Open reads all headers of the archive; entry contents are skipped
+func (d *tarDriver) Open(source io.Reader, config *common.ConversionConfig) (common.RowProvider, error) {
+	provider := &tarProvider{}
+	tr := tar.NewReader(source)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		provider.entries = append(provider.entries, header)
+	}
+	return provider, nil
+}
+
+// tarProvider is the RowProvider of the tar driver
+type tarProvider struct {
+	entries []*tar.Header
+}
+
+var tarHeaders = []string{"name", "modified", "size", "mode", "is_dir", "link_name"}
+
+func (p *tarProvider) GetTableNames() []string {
+	return []string{archiveListingTable}
+}
+
+func (p *tarProvider) GetHeaders(tableName string) []string {
+	if tableName != archiveListingTable {
+		return nil
+	}
+	return common.GenColumnNames(tarHeaders)
+}
+
+func (p *tarProvider) ScanRows(tableName string, yield func([]interface{}, error) error) error {
+	if tableName != archiveListingTable {
+		return nil
+	}
+
+	for _, h := range p.entries {
+		isDir := "false"
+		if h.Typeflag == tar.TypeDir {
+			isDir = "true"
+		}
+		values := []interface{}{
+			cleanEntryName(h.Name),
+			h.ModTime.UTC().Format(time.RFC3339),
+			h.Size,
+			fmt.Sprintf("%o", h.Mode),
+			isDir,
+			h.Linkname,
+		}
+		if err := yield(values, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package flight
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,23 +14,6 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
-var extensionMap = map[string]string{
-	".csv":      "csv",
-	".xlsx":     "excel",
-	".xls":      "excel",
-	".tbc":      "excel", // old tbc support? just copy map
-	".zip":      "zip",
-	".html":     "html",
-	".htm":      "html",
-	".json":     "json",
-	".txt":      "txt",
-	".md":       "markdown",
-	".markdown": "markdown",
-	".db":       "sqlite",
-	".sqlite":   "sqlite",
-	".sqlite3":  "sqlite",
-}
-
 func HandleBanquet(e *core.RequestEvent, verbose bool) error {
 	// 1. Parse Banquet URL
 	reqURI := e.Request.RequestURI
@@ -41,6 +25,9 @@ func HandleBanquet(e *core.RequestEvent, verbose bool) error {
 		return NewBanquetError(err, "Invalid banquet URL format", 400, nil, "", "")
 	}
 
+	// Members of zip archives are datasets of their own (banquet stops at the .zip)
+	ExpandArchivePath(b)
+
 	if verbose {
 		banquet.FmtPrintln(b)
 	}
@@ -91,10 +78,25 @@ func HandleBanquet(e *core.RequestEvent, verbose bool) error {
 		return NewBanquetError(nil, "Rclone manager not initialized", 500, b, "", "")
 	}
 
-	vfs, err := rcloneManager.GetVFS(remoteRecord)
+	// Remotes scoped into another remote's root read through that remote's backend
+	vfsRecord, err := ResolveRemote(e.App, remoteRecord)
+	if err != nil {
+		return NewBanquetError(err, fmt.Sprintf("Remote '%s' is misconfigured", b.Hostname()), 500, b, "", "")
+	}
+
+	vfs, releaseVFS, err := rcloneManager.AcquireVFS(vfsRecord)
 	if err != nil {
+		if errors.Is(err, ErrVFSLimit) {
+			return NewBanquetError(err, "Too many remotes in use, please retry shortly", 503, b, "", "")
+		}
 		return NewBanquetError(err, "Failed to initialize VFS", 500, b, "", "")
 	}
+	defer releaseVFS()
+
+	// The archive's listing tells zip members from folders and tables
+	if err := resolveRemoteArchiveMember(e.App, rcloneManager, vfs, remoteRecord, b); err != nil {
+		return NewBanquetError(err, "Failed to read archive", 500, b, "", "")
+	}
 
 	// 4. Generate Cache Key
 	cacheKey := GenCacheKey(b)
@@ -105,72 +107,146 @@ func HandleBanquet(e *core.RequestEvent, verbose bool) error {
 		log.Printf("[BANQUET] Cache path: %s", cachePath)
 	}
 
+	// Keep the janitor away from this entry while it is built and served
+	release := AcquireCache(cachePath)
+	defer release()
+
+	// A path continuing past an archive addresses one of its entries; the archive is fetched
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+
 	// 5. Check Cache Validity
-	// Get TTL from data_pipelines or use default (24 hours = 1440 minutes)
-	ttl := 1440.0
+	// TTL comes from the matching data_pipeline, the remote, app_settings or the 24h default
+	ttl := ResolveCacheTTL(e.App, remoteRecord, b.DataSetPath)
+	// Driver and arguments from the pipeline's mksqlite_config or a per-extension default
+	convert := ResolveConvertOptions(e.App, remoteRecord, b.DataSetPath)
+	if verbose {
+		log.Printf("[BANQUET] Cache TTL: %.0f minutes", ttl)
+	}
 	valid, err := ValidateCache(cachePath, ttl)
 	if err != nil {
 		log.Printf("[BANQUET] Cache validation error: %v", err)
 		valid = false
 	}
 
-	// 6. Fetch and Convert if Cache Miss
-	if !valid {
+	// ?refresh=1 rebuilds the cache for this request regardless of TTL and fingerprint
+	refresh := wantsRefresh(e)
+	if refresh {
+		valid = false
 		if verbose {
-			log.Printf("[BANQUET] Cache miss or expired, fetching and converting...")
+			log.Printf("[BANQUET] Refresh requested, bypassing cache")
+		}
+	}
+
+	// Within the TTL the source is still checked now and then, so a changed file is rebuilt
+	// instead of being served stale until the cache expires
+	if valid && sourceCheckDue(cachePath, GetSourceCheckInterval(e.App)) {
+		if node, err := rcloneManager.Stat(vfs, archivePath); err == nil && !node.IsDir() {
+			fingerprint := NodeFingerprint(node)
+			fingerprint.Convert = convert.Hash()
+			if SourceChanged(cachePath, fingerprint) {
+				valid = false
+				if verbose {
+					log.Printf("[BANQUET] Source changed since the cache was built (%s), rebuilding", fingerprint)
+				}
+			}
 		}
+	}
 
+	// Reported in the X-Flight-Cache response header: hit, revalidated, stale or miss
+	cacheStatus := "hit"
+
+	// 6. Fetch and Convert if Cache Miss
+	if !valid {
+		cacheStatus = "miss"
 		// Check if it's a directory or a file
-		node, err := rcloneManager.Stat(vfs, b.DataSetPath)
+		node, err := rcloneManager.Stat(vfs, archivePath)
 		if err != nil {
 			return NewBanquetError(err, fmt.Sprintf("Failed to access remote path: %s", b.DataSetPath), 404, b, "", "")
 		}
 
-		if node.IsDir() {
-			// Remote directory - index it
-			if err := rcloneManager.IndexDirectory(vfs, b.DataSetPath, cachePath); err != nil {
-				return NewBanquetError(err, "Failed to index remote directory", 500, b, "", cachePath)
+		// Expired but the source is unchanged since the cache was built: renew instead of re-downloading.
+		// This is the remote counterpart of HandleLocalDataset's "cache newer than source" check.
+		fingerprint := NodeFingerprint(node)
+		fingerprint.Convert = convert.Hash()
+		if !refresh && !node.IsDir() && SourceUnchanged(cachePath, fingerprint) {
+			if err := RenewCache(cachePath); err != nil {
+				log.Printf("[BANQUET] Warning: failed to renew cache: %v", err)
+			}
+			RecordCacheHit(e.App, cacheKey)
+			cacheStatus = "revalidated"
+			if verbose {
+				log.Printf("[BANQUET] Cache expired but source unchanged (%s), renewed", fingerprint)
 			}
-			// When indexing a directory, the resulting table name in the cache is always 'tb0'
-			b.Table = "tb0"
 		} else {
-			// Remote file - fetch and convert
-			tempDir := filepath.Join(e.App.DataDir(), "temp")
-			if err := os.MkdirAll(tempDir, 0755); err != nil {
-				return NewBanquetError(err, "Failed to create temp directory", 500, b, "", cachePath)
+			if verbose {
+				log.Printf("[BANQUET] Cache miss or expired, fetching and converting...")
 			}
 
-			rawFilePath := filepath.Join(tempDir, cacheKey+filepath.Ext(b.DataSetPath))
-			// Construct fetch path with query parameters if present
-			fetchPath := b.DataSetPath
-			if b.URL.RawQuery != "" {
-				fetchPath += "?" + b.URL.RawQuery
+			// Construct fetch path with the query parameters meant for the source (also part of cacheKey)
+			fetchPath := archivePath
+			if query := FetchQuery(b); query != "" {
+				fetchPath += "?" + query
 			}
 
-			if err := rcloneManager.FetchFile(vfs, fetchPath, rawFilePath); err != nil {
-				return NewBanquetError(err, fmt.Sprintf("Failed to fetch file: %s", b.DataSetPath), 500, b, "", cachePath)
+			build := &remoteBuild{
+				App:          e.App,
+				Rclone:       rcloneManager,
+				VFS:          vfs,
+				RemoteRecord: remoteRecord,
+				DataSetPath:  b.DataSetPath,
+				EntryPath:    entryPath,
+				ArchiveKey:   archiveCacheKey(b, archivePath),
+				FetchPath:    fetchPath,
+				SourceURL:    datasetURL(b),
+				CacheKey:     cacheKey,
+				CachePath:    cachePath,
+				Convert:      convert,
+				Verbose:      verbose,
 			}
 
-			// 6b. Convert to SQLite using mksqlite
-			if err := ConvertToSQLite(rawFilePath, cachePath); err != nil {
-				os.Remove(rawFilePath) // Cleanup on error
-				return NewBanquetError(err, "Failed to convert file to SQLite", 500, b, "", cachePath)
-			}
+			// Stale-while-revalidate: serve the expired database now and refresh it in the
+			// background; the atomic publish swaps in the new one for later requests.
+			if !refresh && cacheExists(cachePath) && ResolveStaleWhileRevalidate(e.App, remoteRecord, b.DataSetPath) {
+				build.RunInBackground(node)
+				RecordCacheHit(e.App, cacheKey)
+				cacheStatus = "stale"
+				if verbose {
+					log.Printf("[BANQUET] Serving stale cache while refreshing in the background")
+				}
+			} else {
+				// Concurrent requests for the same key share one build
+				shared, err := cacheBuilds.Do(cacheKey, cacheBuildWait, func() error {
+					// A build that finished just before we got here already made the cache valid
+					if valid, _ := ValidateCache(cachePath, ttl); valid && !refresh && !SourceChanged(cachePath, fingerprint) {
+						return nil
+					}
+					return build.Run(node)
+				})
+				if err != nil {
+					if errors.Is(err, ErrBuildWaitTimeout) {
+						return NewBanquetError(err, "Dataset is still being prepared, please retry shortly", 503, b, "", cachePath)
+					}
+					if errors.Is(err, ErrArchiveEntryNotFound) {
+						return NewBanquetError(err, fmt.Sprintf("%s not found in %s", entryPath, archivePath), 404, b, "", cachePath)
+					}
+					return NewBanquetError(err, "Failed to fetch and convert dataset", 500, b, "", cachePath)
+				}
 
-			// 6c. Cleanup temp file
-			if err := os.Remove(rawFilePath); err != nil {
-				log.Printf("[BANQUET] Warning: failed to cleanup temp file: %v", err)
+				if verbose {
+					if shared {
+						log.Printf("[BANQUET] Joined build started by another request")
+					}
+					log.Printf("[BANQUET] Data processed successfully")
+				}
 			}
 		}
 
-		if verbose {
-			log.Printf("[BANQUET] Data processed successfully")
-		}
-
-		if verbose {
-			log.Printf("[BANQUET] File fetched and converted successfully")
+		if node.IsDir() {
+			// When indexing a directory, the resulting table name in the cache is always 'tb0'
+			b.Table = "tb0"
 		}
 	} else {
+		RecordCacheHit(e.App, cacheKey)
 		if verbose {
 			log.Printf("[BANQUET] Cache hit, serving from cache")
 		}
@@ -196,8 +272,18 @@ func HandleBanquet(e *core.RequestEvent, verbose bool) error {
 		return NewBanquetError(nil, "SQLiter server not initialized", 500, b, "", cachePath)
 	}
 
+	// Opens the only data table instead of a listing that includes the search index
+	if err := applyDefaultTable(e, b, cachePath); err != nil {
+		return NewBanquetError(err, "Failed to read dataset", 500, b, "", cachePath)
+	}
+	// ?q= becomes a full-text match SQLiter can run
+	if err := applySearch(e, b, cachePath); err != nil {
+		return searchError(err, b, cachePath)
+	}
+
 	// Serve SQLiter's React UI directly (no redirect)
 	// This keeps the Banquet URL in the browser
+	e.Response.Header().Set("X-Flight-Cache", cacheStatus)
 	sqliterServer.ServeHTTP(e.Response, e.Request)
 	return nil
 }
@@ -209,51 +295,10 @@ func HandleLocalDataset(e *core.RequestEvent, b *banquet.Banquet, verbose bool)
 		log.Printf("[LOCAL] Handling local dataset: %s", b.DataSetPath)
 	}
 
-	// 1. Resolve local file path
-	// Look up serve_folder in app_settings
-	baseDir := filepath.Join(e.App.DataDir(), "..", "pb_public") // Default
-
-	// Try to find serve_folder setting - dynamic lookup prevents restart requirement
-	if record, err := e.App.FindFirstRecordByData("app_settings", "key", "serve_folder"); err == nil && record != nil {
-		if val := record.GetString("value"); val != "" {
-			// Expand home directory ~
-			if strings.HasPrefix(val, "~/") || val == "~" {
-				if homeDir, err := os.UserHomeDir(); err == nil {
-					if val == "~" {
-						val = homeDir
-					} else {
-						val = filepath.Join(homeDir, val[2:])
-					}
-				}
-			}
-
-			if filepath.IsAbs(val) {
-				baseDir = val
-			} else {
-				// Treat relative paths as relative to the application root (parent of pb_data)
-				baseDir = filepath.Join(e.App.DataDir(), "..", val)
-			}
-			if verbose {
-				log.Printf("[LOCAL] Using configured serve_folder: %s", baseDir)
-			}
-		}
-	}
-
-	// DataSetPath should be relative to baseDir or an absolute path
-	var localFilePath string
-
-	// Handle empty path (root request)
-	if b.DataSetPath == "" || b.DataSetPath == "/" {
-		localFilePath = baseDir
-	} else if filepath.IsAbs(b.DataSetPath) {
-		localFilePath = b.DataSetPath
-	} else {
-		// Relative to base directory
-		localFilePath = filepath.Join(baseDir, b.DataSetPath)
-	}
-
-	// Clean the path
-	localFilePath = filepath.Clean(localFilePath)
+	// 1. Resolve local file path (relative to serve_folder, or absolute); for a path that
+	// continues past an archive, the archive is resolved and the entry extracted from it
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+	localFilePath := ResolveLocalPath(e.App, archivePath)
 
 	if verbose {
 		log.Printf("[LOCAL] Resolved file path: %s", localFilePath)
@@ -267,53 +312,70 @@ func HandleLocalDataset(e *core.RequestEvent, b *banquet.Banquet, verbose bool)
 		}
 		return NewBanquetError(err, "Error accessing local file", 500, b, "", "")
 	}
+	if entryPath != "" && !fileInfo.IsDir() {
+		if err := ResolveArchiveMember(b, localFilePath); err != nil {
+			return NewBanquetError(err, "Failed to read archive", 500, b, "", "")
+		}
+		_, entryPath = SplitArchivePath(b.DataSetPath)
+	}
 
 	// 3. Determine Cache Path
-	var cachePath string
-	flatPath := strings.ReplaceAll(localFilePath, "/", "_")
-	flatPath = strings.ReplaceAll(flatPath, "\\", "_")
-
+	cacheKey, cachePath := localCacheLocation(e.App, filepath.Join(localFilePath, entryPath), fileInfo.IsDir())
 	if fileInfo.IsDir() {
-		// Try index.sqlite in the folder
-		localIndexPath := filepath.Join(localFilePath, "index.sqlite")
-		if isWritable(localFilePath) {
-			cachePath = localIndexPath
-		} else {
-			// Fallback to global cache with flattened name
-			cachePath = filepath.Join(e.App.DataDir(), "cache", flatPath+".db")
-		}
 		// Ensure table assumption for directories
 		b.Table = "tb0"
-	} else {
-		// File: use global cache with flattened path
-		cachePath = filepath.Join(e.App.DataDir(), "cache", flatPath+".db")
 	}
 
 	if verbose {
 		log.Printf("[LOCAL] Cache path: %s", cachePath)
 	}
 
+	release := AcquireCache(cachePath)
+	defer release()
+
 	// 4. Check Cache Validity
-	ttl := 1440.0 // 24 hours default
+	ttl := ResolveCacheTTL(e.App, nil, b.DataSetPath)
+	build := &localBuild{
+		App:       e.App,
+		LocalPath: localFilePath,
+		EntryPath: entryPath,
+		Info:      fileInfo,
+		SourceURL: datasetURL(b),
+		CacheKey:  cacheKey,
+		CachePath: cachePath,
+		Convert:   ResolveConvertOptions(e.App, nil, b.DataSetPath),
+	}
 	valid, err := ValidateCache(cachePath, ttl)
 	if err != nil {
 		log.Printf("[LOCAL] Cache validation error: %v", err)
 		valid = false
 	}
 
+	refresh := wantsRefresh(e)
+	if refresh {
+		valid = false
+	}
+
+	// Reported in the X-Flight-Cache response header, as for remote datasets
+	cacheStatus := "hit"
+
 	// 5. Convert if Cache Miss
 	if !valid {
+		cacheStatus = "miss"
 		if verbose {
 			log.Printf("[LOCAL] Cache miss or expired, converting local file...")
 		}
 
 		// Check if source file is newer than cache
 		sourceInfo, _ := os.Stat(localFilePath)
-		if sourceInfo != nil {
-			cacheInfo, err := os.Stat(cachePath)
-			if err == nil && cacheInfo.Size() > 0 && cacheInfo.ModTime().After(sourceInfo.ModTime()) {
-				// Cache is newer than source and not empty, use it
+		if sourceInfo != nil && !refresh {
+			cacheInfo, err := os.Lstat(cachePath)
+			if err == nil && cacheInfo.Size() > 0 && cacheInfo.ModTime().After(sourceInfo.ModTime()) &&
+				(fileInfo.IsDir() || SourceUnchanged(cachePath, build.Fingerprint())) {
+				// Cache is newer than source, not empty and built with the current mksqlite_config, use it
 				valid = true
+				RecordCacheHit(e.App, cacheKey)
+				cacheStatus = "revalidated"
 				if verbose {
 					log.Printf("[LOCAL] Cache is newer than source file, using cache")
 				}
@@ -321,8 +383,20 @@ func HandleLocalDataset(e *core.RequestEvent, b *banquet.Banquet, verbose bool)
 		}
 
 		if !valid {
-			// Convert to SQLite (File or Directory)
-			if err := ConvertToSQLite(localFilePath, cachePath); err != nil {
+			// Convert to SQLite (File or Directory); concurrent requests share one conversion
+			_, err := cacheBuilds.Do(cacheKey, cacheBuildWait, func() error {
+				if valid, _ := ValidateCache(cachePath, ttl); valid && !refresh {
+					return nil
+				}
+				return build.Run()
+			})
+			if err != nil {
+				if errors.Is(err, ErrBuildWaitTimeout) {
+					return NewBanquetError(err, "Dataset is still being prepared, please retry shortly", 503, b, "", cachePath)
+				}
+				if errors.Is(err, ErrArchiveEntryNotFound) {
+					return NewBanquetError(err, fmt.Sprintf("%s not found in %s", entryPath, archivePath), 404, b, "", cachePath)
+				}
 				return NewBanquetError(err, "Failed to convert local file/directory to SQLite", 500, b, "", cachePath)
 			}
 
@@ -336,6 +410,7 @@ func HandleLocalDataset(e *core.RequestEvent, b *banquet.Banquet, verbose bool)
 			b.Table = "tb0"
 		}
 	} else {
+		RecordCacheHit(e.App, cacheKey)
 		// Cache hit, but ensure table is correct if it's a directory
 		if fileInfo.IsDir() {
 			b.Table = "tb0"
@@ -356,11 +431,27 @@ func HandleLocalDataset(e *core.RequestEvent, b *banquet.Banquet, verbose bool)
 		return NewBanquetError(nil, "SQLiter server not initialized", 500, b, "", cachePath)
 	}
 
+	if err := applyDefaultTable(e, b, cachePath); err != nil {
+		return NewBanquetError(err, "Failed to read dataset", 500, b, "", cachePath)
+	}
+	if err := applySearch(e, b, cachePath); err != nil {
+		return searchError(err, b, cachePath)
+	}
+
 	// Serve SQLiter's React UI directly (no redirect)
+	e.Response.Header().Set("X-Flight-Cache", cacheStatus)
 	sqliterServer.ServeHTTP(e.Response, e.Request)
 	return nil
 }
 
+// searchError maps a failed ?q= rewrite to the banquet error page
+func searchError(err error, b *banquet.Banquet, cachePath string) error {
+	if errors.Is(err, ErrNoSearchIndex) {
+		return NewBanquetError(err, "Full-text search is not enabled for this dataset (set fts on its mksqlite_config)", 400, b, "", cachePath)
+	}
+	return NewBanquetError(err, "Failed to search dataset", 500, b, "", cachePath)
+}
+
 // isWritable checks if a directory is writable by attempting to create a temp file
 func isWritable(path string) bool {
 	testFile := filepath.Join(path, ".perm_test_"+fmt.Sprintf("%d", time.Now().UnixNano()))
@@ -372,3 +463,57 @@ func isWritable(path string) bool {
 	os.Remove(testFile)
 	return true
 }
+
+// ResolveLocalPath maps a local DataSetPath to a file system path. Relative paths are
+// resolved against the serve_folder app setting (default pb_public next to pb_data),
+// which is looked up on every call so changes apply without a restart.
+func ResolveLocalPath(app core.App, datasetPath string) string {
+	baseDir := filepath.Join(app.DataDir(), "..", "pb_public") // Default
+
+	if val := GetAppSetting(app, "serve_folder"); val != "" {
+		// Expand home directory ~
+		if strings.HasPrefix(val, "~/") || val == "~" {
+			if homeDir, err := os.UserHomeDir(); err == nil {
+				if val == "~" {
+					val = homeDir
+				} else {
+					val = filepath.Join(homeDir, val[2:])
+				}
+			}
+		}
+
+		if filepath.IsAbs(val) {
+			baseDir = val
+		} else {
+			// Treat relative paths as relative to the application root (parent of pb_data)
+			baseDir = filepath.Join(app.DataDir(), "..", val)
+		}
+	}
+
+	// DataSetPath should be relative to baseDir or an absolute path
+	var localFilePath string
+
+	// Handle empty path (root request)
+	if datasetPath == "" || datasetPath == "/" {
+		localFilePath = baseDir
+	} else if filepath.IsAbs(datasetPath) {
+		localFilePath = datasetPath
+	} else {
+		// Relative to base directory
+		localFilePath = filepath.Join(baseDir, datasetPath)
+	}
+
+	return filepath.Clean(localFilePath)
+}
+
+// localCacheLocation returns the cache key and database path for a local file or directory.
+// Directories are indexed into index.sqlite inside the folder when it is writable.
+func localCacheLocation(app core.App, localFilePath string, isDir bool) (cacheKey, cachePath string) {
+	cacheKey = LocalCacheKey(localFilePath)
+
+	if isDir && isWritable(localFilePath) {
+		return cacheKey, filepath.Join(localFilePath, "index.sqlite")
+	}
+	// Files and read-only folders: use global cache
+	return cacheKey, GetCachePath(app.DataDir(), cacheKey)
+}
@@ -0,0 +1,199 @@
+package flight
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/vfs"
+)
+
+// remoteBuild is one fetch+convert (or directory index) of a remote dataset into the cache.
+// It holds everything the build needs so it does not depend on the request that triggered it.
+type remoteBuild struct {
+	App          core.App
+	Rclone       *RcloneManager
+	VFS          *vfs.VFS
+	RemoteRecord *core.Record
+	DataSetPath  string // path on the remote
+	EntryPath    string // file or folder inside the archive DataSetPath continues past, see SplitArchivePath
+	ArchiveKey   string // archiveCacheKey of that archive, set with EntryPath
+	FetchPath    string // DataSetPath (the archive for entries) plus query string for ad-hoc HTTP remotes
+	SourceURL    string // recorded in cache_entries
+	CacheKey     string
+	CachePath    string
+	Convert      *ConvertOptions // mksqlite_config, see ResolveConvertOptions
+	Verbose      bool
+}
+
+// Run builds the cache for node (the Stat result of DataSetPath, or of the archive for
+// entries), records the source fingerprint and the cache_entries manifest entry.
+func (rb *remoteBuild) Run(node vfs.Node) error {
+	release := AcquireCache(rb.CachePath)
+	defer release()
+
+	buildStart := time.Now()
+	fingerprint := NodeFingerprint(node)
+	fingerprint.Convert = rb.Convert.Hash()
+	entry := CacheEntry{
+		CacheKey:   rb.CacheKey,
+		CachePath:  rb.CachePath,
+		SourceURL:  rb.SourceURL,
+		RemoteID:   remoteRecordID(rb.RemoteRecord),
+		SourcePath: rb.DataSetPath,
+	}
+
+	if node.IsDir() {
+		// Remote directory - index it
+		if err := rb.Rclone.IndexDirectory(rb.VFS, rb.DataSetPath, rb.CachePath); err != nil {
+			return fmt.Errorf("failed to index remote directory: %w", err)
+		}
+		entry.Driver = "index"
+	} else if rb.EntryPath != "" {
+		// Entry of a remote archive - fetched once into the archive cache, then extracted
+		archiveFile, releaseArchive, err := rb.fetchArchive(node)
+		if err != nil {
+			return err
+		}
+		defer releaseArchive()
+
+		result, err := convertArchiveEntry(rb.App, archiveFile, rb.EntryPath, rb.DataSetPath, rb.CacheKey, rb.CachePath, rb.Convert)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %w", rb.DataSetPath, err)
+		}
+		entry.Driver = result.Driver
+		entry.Fingerprint = fingerprint.String()
+		entry.ArchiveKey = rb.ArchiveKey
+
+		if err := WriteFingerprint(rb.CachePath, fingerprint); err != nil {
+			log.Printf("[BANQUET] Warning: failed to record source fingerprint: %v", err)
+		}
+	} else {
+		// Remote file - converted as a stream from the VFS, local remotes straight from disk
+		var result *ConvertResult
+		var err error
+		if localPath, ok := rb.Rclone.LocalPath(rb.VFS, rb.DataSetPath); ok {
+			result, err = convertInPlace(localPath, rb.CachePath, rb.Convert)
+		} else {
+			result, err = rb.convertStream()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to convert file to SQLite: %w", err)
+		}
+		entry.Driver = result.Driver
+		entry.Fingerprint = fingerprint.String()
+
+		// Remember which version of the source this cache was built from
+		if err := WriteFingerprint(rb.CachePath, fingerprint); err != nil {
+			log.Printf("[BANQUET] Warning: failed to record source fingerprint: %v", err)
+		}
+	}
+
+	entry.BuildTime = time.Since(buildStart)
+	if err := RecordCacheBuild(rb.App, entry); err != nil {
+		log.Printf("[BANQUET] Warning: failed to record cache entry: %v", err)
+	}
+
+	if rb.Verbose {
+		log.Printf("[BANQUET] Built %s in %s", rb.CacheKey, entry.BuildTime)
+	}
+	return nil
+}
+
+// convertStream converts the remote file straight from a VFS handle. The Content-Type
+// helps with extensionless URLs.
+func (rb *remoteBuild) convertStream() (*ConvertResult, error) {
+	handle, contentType, err := rb.Rclone.OpenFile(rb.VFS, rb.FetchPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch file %s: %w", rb.DataSetPath, err)
+	}
+	defer handle.Close()
+
+	tempDir := filepath.Join(rb.App.DataDir(), "temp")
+	return ConvertReader(handle, rb.DataSetPath, rb.CachePath, tempDir, rb.Convert.WithContentType(contentType))
+}
+
+// localBuild converts a local file or indexes a local directory into the cache.
+type localBuild struct {
+	App       core.App
+	LocalPath string
+	EntryPath string      // file or folder inside the archive at LocalPath, see SplitArchivePath
+	Info      os.FileInfo // Stat result of LocalPath
+	SourceURL string      // recorded in cache_entries
+	CacheKey  string
+	CachePath string
+	Convert   *ConvertOptions // mksqlite_config, see ResolveConvertOptions
+}
+
+// Run converts LocalPath and records the cache_entries manifest entry
+func (lb *localBuild) Run() error {
+	buildStart := time.Now()
+	var result *ConvertResult
+	var err error
+	if lb.EntryPath != "" {
+		entryPath := filepath.ToSlash(filepath.Join(lb.LocalPath, lb.EntryPath))
+		result, err = convertArchiveEntry(lb.App, lb.LocalPath, lb.EntryPath, entryPath, lb.CacheKey, lb.CachePath, lb.Convert)
+	} else {
+		result, err = ConvertSource(lb.LocalPath, lb.CachePath, lb.Convert)
+	}
+	if err != nil {
+		return err
+	}
+
+	fingerprint := lb.Fingerprint()
+	if !lb.Info.IsDir() {
+		// Directories are indexed into the folder itself, keep sidecars out of it
+		if err := WriteFingerprint(lb.CachePath, fingerprint); err != nil {
+			log.Printf("[LOCAL] Warning: failed to record source fingerprint: %v", err)
+		}
+	}
+
+	err = RecordCacheBuild(lb.App, CacheEntry{
+		CacheKey:    lb.CacheKey,
+		CachePath:   lb.CachePath,
+		SourceURL:   lb.SourceURL,
+		SourcePath:  filepath.Join(lb.LocalPath, lb.EntryPath),
+		Fingerprint: fingerprint.String(),
+		Driver:      result.Driver,
+		BuildTime:   time.Since(buildStart),
+	})
+	if err != nil {
+		log.Printf("[LOCAL] Warning: failed to record cache entry: %v", err)
+	}
+	return nil
+}
+
+// Fingerprint returns the fingerprint of the local source and conversion options
+func (lb *localBuild) Fingerprint() SourceFingerprint {
+	return SourceFingerprint{
+		ModTime: lb.Info.ModTime().UTC(),
+		Size:    lb.Info.Size(),
+		Convert: lb.Convert.Hash(),
+	}
+}
+
+// RunInBackground starts Run in its own goroutine unless a build for the same key is
+// already in flight. The result is published atomically, so readers switch from the
+// stale database to the new one without ever seeing a partial file.
+func (rb *remoteBuild) RunInBackground(node vfs.Node) {
+	if cacheBuilds.InFlight(rb.CacheKey) {
+		return
+	}
+
+	// The request that started the refresh releases its VFS lease when it returns
+	releaseVFS := rb.Rclone.retainVFS(rb.VFS)
+	go func() {
+		defer releaseVFS()
+		log.Printf("[BANQUET] Background refresh of %s started", rb.CacheKey)
+		if _, err := cacheBuilds.Do(rb.CacheKey, cacheBuildWait, func() error {
+			return rb.Run(node)
+		}); err != nil {
+			log.Printf("[BANQUET] Background refresh of %s failed: %v", rb.CacheKey, err)
+			return
+		}
+		log.Printf("[BANQUET] Background refresh of %s finished", rb.CacheKey)
+	}()
+}
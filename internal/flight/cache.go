@@ -1,43 +1,130 @@
 package flight
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/darianmavgo/banquet"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
 )
 
+// DefaultCacheTTL is the cache TTL in minutes (24 hours) used when nothing more specific is configured
+const DefaultCacheTTL = 1440.0
+
+// CacheKeyVersion prefixes every cache key. Bump it whenever the key derivation changes;
+// MigrateCacheKeys drops entries built under an older scheme.
+const CacheKeyVersion = "v2"
+
+// cacheKeyReadableMax bounds the human readable part of a cache key
+const cacheKeyReadableMax = 80
+
+// banquetQueryParams are query parameters interpreted by banquet/SQLiter. They shape the
+// SQL query, not the fetched bytes, so they are neither part of the key nor sent to the source.
+var banquetQueryParams = map[string]bool{
+	"where":   true,
+	"groupby": true,
+	"having":  true,
+	"orderby": true,
+	"limit":   true,
+	"offset":  true,
+	"refresh": true, // see wantsRefresh
+	"q":       true, // full-text search, see applySearch
+}
+
 // GenCacheKey generates a cache key based on the banquet request.
 // The auth alias "b.User" already contains config hash for disambiguation.
 // Deliberately not including scheme since file could be pulled via s3 or https in some situations.
+// Query parameters sent to the source (see FetchQuery) are part of the key, so
+// report.csv?month=1 and report.csv?month=2 are cached separately. The readable part
+// names the inner file of compressed sources (data.csv.gz reads as data.csv).
 func GenCacheKey(b *banquet.Banquet) string {
 	userInfo := ""
 	if b.User != nil {
 		userInfo = b.User.String()
 	}
-	parts := []string{userInfo, b.Hostname(), b.DataSetPath}
-	// Filter out empty parts
-	var filtered []string
+	return cacheKeyFromParts(b.Hostname()+trimCompressionExt(b.DataSetPath), "remote", userInfo, b.Hostname(), b.DataSetPath, FetchQuery(b))
+}
+
+// LocalCacheKey generates the cache key for a local file or directory
+func LocalCacheKey(localFilePath string) string {
+	return cacheKeyFromParts(trimCompressionExt(filepath.Base(localFilePath)), "local", filepath.ToSlash(localFilePath))
+}
+
+// cacheKeyFromParts builds "<version>-<readable>-<hash>". The readable part only helps
+// humans browsing pb_data/cache; uniqueness comes from a SHA-256 over the length-prefixed
+// parts, so distinct inputs (e.g. /a/b.csv and /a_b.csv) never share a key.
+func cacheKeyFromParts(readable string, parts ...string) string {
+	h := sha256.New()
 	for _, p := range parts {
-		if p != "" {
-			filtered = append(filtered, p)
+		fmt.Fprintf(h, "%d:%s;", len(p), p)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))[:24]
+
+	var sb strings.Builder
+	lastSep := true
+	for _, r := range readable {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+			sb.WriteRune(r)
+			lastSep = false
+		case !lastSep:
+			sb.WriteRune('_')
+			lastSep = true
 		}
 	}
-	key := strings.Join(filtered, "-")
-	// Replace slashes with underscores to keep a flat file structure
-	key = strings.ReplaceAll(key, "/", "_")
-	// Also clean up any double underscores or double dashes
-	key = strings.ReplaceAll(key, "--", "-")
-	key = strings.ReplaceAll(key, "__", "_")
-	return key
+	name := strings.Trim(sb.String(), "_.")
+	if len(name) > cacheKeyReadableMax {
+		name = name[len(name)-cacheKeyReadableMax:] // keep the file name end
+		name = strings.TrimLeft(name, "_.")
+	}
+	if name == "" {
+		return CacheKeyVersion + "-" + sum
+	}
+	return CacheKeyVersion + "-" + name + "-" + sum
+}
+
+// FetchQuery returns the query string sent to the source with the fetch: the request's raw
+// query without the parameters banquet interprets itself (where, orderby, limit, ...).
+func FetchQuery(b *banquet.Banquet) string {
+	if b.URL == nil || b.URL.RawQuery == "" {
+		return ""
+	}
+
+	var kept []string
+	for _, param := range strings.Split(b.URL.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if banquetQueryParams[strings.ToLower(name)] {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return strings.Join(kept, "&")
+}
+
+// isCurrentCacheKey reports whether a cache key was generated by the current scheme
+func isCurrentCacheKey(cacheKey string) bool {
+	return strings.HasPrefix(cacheKey, CacheKeyVersion+"-")
 }
 
 // ValidateCache checks if cached SQLite file is still valid based on TTL
 func ValidateCache(cachePath string, ttlMinutes float64) (bool, error) {
 	// Check file existence
-	info, err := os.Stat(cachePath)
+	info, err := os.Lstat(cachePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil // Cache doesn't exist
@@ -45,8 +132,17 @@ func ValidateCache(cachePath string, ttlMinutes float64) (bool, error) {
 		return false, err // Some other error
 	}
 
-	// Get file modification time
+	// Get file modification time; for a SQLite source served in place that of the link,
+	// the source's own says nothing about when the cache was built
 	modTime := info.ModTime()
+	if info.Mode()&os.ModeSymlink != 0 {
+		if info, err = os.Stat(cachePath); err != nil {
+			if os.IsNotExist(err) {
+				return false, nil // Source is gone
+			}
+			return false, err
+		}
+	}
 
 	// Calculate age in minutes
 	age := time.Since(modTime).Minutes()
@@ -64,7 +160,97 @@ func ValidateCache(cachePath string, ttlMinutes float64) (bool, error) {
 	return true, nil // Cache is valid
 }
 
+// ResolveCacheTTL returns the cache TTL in minutes for a dataset.
+// Resolution order (first positive value wins):
+//  1. cache_ttl of the data_pipelines record covering the dataset (see FindPipeline)
+//  2. cache_ttl of the rclone_remotes record
+//  3. the "cache_ttl" key in app_settings
+//  4. DefaultCacheTTL
+//
+// remoteRecord may be nil for local datasets.
+func ResolveCacheTTL(app core.App, remoteRecord *core.Record, datasetPath string) float64 {
+	if pipeline := FindPipeline(app, remoteRecord, datasetPath); pipeline != nil {
+		if ttl := pipeline.GetFloat("cache_ttl"); ttl > 0 {
+			return ttl
+		}
+	}
+
+	if remoteRecord != nil {
+		if ttl := remoteRecord.GetFloat("cache_ttl"); ttl > 0 {
+			return ttl
+		}
+	}
+
+	if val := GetAppSetting(app, "cache_ttl"); val != "" {
+		ttl, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err == nil && ttl > 0 {
+			return ttl
+		}
+		log.Printf("[CACHE] Ignoring invalid app_settings cache_ttl: %q", val)
+	}
+
+	return DefaultCacheTTL
+}
+
+// ResolveStaleWhileRevalidate reports whether an expired cache may be served immediately
+// while it is rebuilt in the background. It is enabled by the stale_while_revalidate flag
+// of the matching data_pipelines record or globally by the app setting of the same name.
+func ResolveStaleWhileRevalidate(app core.App, remoteRecord *core.Record, datasetPath string) bool {
+	if pipeline := FindPipeline(app, remoteRecord, datasetPath); pipeline != nil && pipeline.GetBool("stale_while_revalidate") {
+		return true
+	}
+
+	val := strings.ToLower(strings.TrimSpace(GetAppSetting(app, "stale_while_revalidate")))
+	return val == "true" || val == "1" || val == "yes"
+}
+
+// cacheExists reports whether a non-empty cache file is present, regardless of its age
+func cacheExists(cachePath string) bool {
+	info, err := os.Stat(cachePath)
+	return err == nil && info.Size() > 0
+}
+
 // GetCachePath returns the full path to a cache file
 func GetCachePath(dataDir, cacheKey string) string {
 	return filepath.Join(dataDir, "cache", cacheKey+".db")
 }
+
+// MigrateCacheKeys drops cache files and cache_entries records built under an older key
+// scheme. Old keys cannot be mapped to new ones (the old scheme was lossy), so the entries
+// are simply rebuilt on their next request. Returns the number of files removed.
+func MigrateCacheKeys(app core.App) int {
+	cacheDir := filepath.Join(app.DataDir(), "cache")
+	removed := 0
+
+	if entries, err := os.ReadDir(cacheDir); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || filepath.Ext(name) != ".db" || isCurrentCacheKey(strings.TrimSuffix(name, ".db")) {
+				continue
+			}
+			path := filepath.Join(cacheDir, name)
+			if isCacheLeased(path) {
+				continue
+			}
+			removeSQLiteFiles(path)
+			RemoveFingerprint(path)
+			removed++
+		}
+	}
+
+	records, err := app.FindRecordsByFilter("cache_entries", "cache_key !~ {:prefix}", "", 0, 0,
+		dbx.Params{"prefix": CacheKeyVersion + "-%"})
+	if err == nil {
+		for _, record := range records {
+			if err := app.Delete(record); err != nil {
+				log.Printf("[CACHE] Warning: failed to remove outdated cache entry %s: %v", record.GetString("cache_key"), err)
+			}
+		}
+	}
+
+	if removed > 0 || len(records) > 0 {
+		log.Printf("[CACHE] Dropped %d cache files and %d cache entries from before cache key scheme %s",
+			removed, len(records), CacheKeyVersion)
+	}
+	return removed
+}
@@ -0,0 +1,331 @@
+package flight
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CachePurge selects the cache entries to remove. Exactly one selector must be set:
+// URL (one banquet URL), Remote and/or Prefix (everything below a path), or All.
+type CachePurge struct {
+	URL    string `json:"url"`    // banquet URL as requested, e.g. /s3:/sales/reports/today.csv
+	Remote string `json:"remote"` // rclone_remotes name; empty with Prefix selects local datasets
+	Prefix string `json:"prefix"` // source path prefix, on segment boundaries
+	All    bool   `json:"all"`
+}
+
+// ErrInvalidPurge is returned by PurgeCache (and CacheURLLocation) for a request selecting
+// nothing valid: no selector, an unparsable URL or an unknown remote
+var ErrInvalidPurge = errors.New("invalid purge request")
+
+// CachePurgeResult reports what a purge removed
+type CachePurgeResult struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// CacheStats summarizes pb_data/cache
+type CacheStats struct {
+	Entries    int   `json:"entries"`     // cache_entries records
+	Files      int   `json:"files"`       // converted databases in pb_data/cache
+	Bytes      int64 `json:"bytes"`       // size of those databases
+	TotalBytes int64 `json:"total_bytes"` // whole cache directory, including the rclone VFS cache
+	Hits       int   `json:"hits"`        // sum of hit_count over all entries
+	MaxBytes   int64 `json:"max_bytes"`   // cache_max_size quota, 0 = unlimited
+	Building   int   `json:"building"`    // builds currently in flight
+}
+
+// CacheURLLocation returns the cache key and database path HandleBanquet uses for a banquet URL,
+// given as requested (/s3:/sales/today.csv, /reports/jan.csv) or in full (http://host/s3:/...)
+func CacheURLLocation(app core.App, rawURL string) (cacheKey, cachePath string, err error) {
+	rawURL = strings.TrimPrefix(rawURL, "/")
+	if !strings.Contains(rawURL, "://") {
+		// The path alone parses as a local dataset; HandleBanquet sees it below a host
+		rawURL = "http://localhost/" + rawURL
+	}
+	b, err := banquet.ParseNested(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: invalid banquet URL: %v", ErrInvalidPurge, err)
+	}
+	ExpandArchivePath(b)
+
+	if b.Scheme == "" && b.Hostname() == "" {
+		archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+		localFilePath := ResolveLocalPath(app, archivePath)
+		info, err := os.Stat(localFilePath)
+		if err == nil && entryPath != "" && !info.IsDir() {
+			if err := ResolveArchiveMember(b, localFilePath); err != nil {
+				return "", "", err
+			}
+			_, entryPath = SplitArchivePath(b.DataSetPath)
+		}
+		cacheKey, cachePath = localCacheLocation(app, filepath.Join(localFilePath, entryPath), err == nil && info.IsDir())
+		return cacheKey, cachePath, nil
+	}
+
+	// Resolved against the archive when it was downloaded already
+	if archivePath, entryPath := SplitArchivePath(b.DataSetPath); entryPath != "" {
+		archiveFile := archiveFilePath(app, archiveCacheKey(b, archivePath), archivePath)
+		if cacheExists(archiveFile) {
+			if err := ResolveArchiveMember(b, archiveFile); err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	cacheKey = GenCacheKey(b)
+	return cacheKey, GetCachePath(app.DataDir(), cacheKey), nil
+}
+
+// PurgeCache removes the selected cache databases, their fingerprint sidecars and
+// cache_entries records. The next request for a purged dataset rebuilds it.
+func PurgeCache(app core.App, purge CachePurge) (*CachePurgeResult, error) {
+	result := &CachePurgeResult{}
+
+	switch {
+	case purge.All:
+		records, err := app.FindAllRecords("cache_entries")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cache entries: %w", err)
+		}
+		for _, record := range records {
+			result.add(purgeCacheFile(app, record.GetString("cache_key"), record.GetString("cache_path")))
+		}
+
+		// Databases without a manifest entry (built before it existed or after a failed save)
+		cacheDir := filepath.Join(app.DataDir(), "cache")
+		entries, _ := os.ReadDir(cacheDir)
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".db" {
+				continue
+			}
+			result.add(purgeCacheFile(app, strings.TrimSuffix(entry.Name(), ".db"), filepath.Join(cacheDir, entry.Name())))
+		}
+
+		// Archives kept for extracting their entries
+		archiveDir := filepath.Join(cacheDir, "archives")
+		archives, _ := os.ReadDir(archiveDir)
+		for _, entry := range archives {
+			archiveFile := filepath.Join(archiveDir, entry.Name())
+			if info, err := entry.Info(); err == nil && !strings.HasSuffix(entry.Name(), ".source.json") && os.Remove(archiveFile) == nil {
+				result.add(info.Size())
+				RemoveFingerprint(archiveFile)
+			}
+		}
+
+	case purge.URL != "":
+		cacheKey, cachePath, err := CacheURLLocation(app, purge.URL)
+		if err != nil {
+			return nil, err
+		}
+		result.add(purgeCacheFile(app, cacheKey, cachePath))
+
+	case purge.Remote != "" || purge.Prefix != "":
+		// An empty relation only matches the literal '', not an empty placeholder value
+		remoteID, filter := "", "rclone_remote = ''"
+		if purge.Remote != "" {
+			// Not LookupRemote: caches of disabled remotes can be purged too
+			remote, err := app.FindFirstRecordByData("rclone_remotes", "name", purge.Remote)
+			if err != nil {
+				return nil, fmt.Errorf("%w: remote '%s' not found", ErrInvalidPurge, purge.Remote)
+			}
+			remoteID, filter = remote.Id, "rclone_remote = {:remote}"
+		}
+
+		records, err := app.FindRecordsByFilter("cache_entries", filter, "", 0, 0,
+			map[string]any{"remote": remoteID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cache entries: %w", err)
+		}
+		prefix := normalizePipelinePath(purge.Prefix)
+		for _, record := range records {
+			if remoteID == "" {
+				// Local entries record the resolved file path, match the prefix against serve_folder too
+				if !pathHasPrefix(normalizePipelinePath(record.GetString("source_path")), normalizePipelinePath(ResolveLocalPath(app, prefix))) {
+					continue
+				}
+			} else if !pathHasPrefix(normalizePipelinePath(record.GetString("source_path")), prefix) {
+				continue
+			}
+			result.add(purgeCacheFile(app, record.GetString("cache_key"), record.GetString("cache_path")))
+		}
+		purgeArchives(app, records, result)
+
+	default:
+		return nil, fmt.Errorf("%w: nothing to purge, set url, remote, prefix or all", ErrInvalidPurge)
+	}
+
+	log.Printf("[CACHE] Purged %d cache files (%d bytes)", result.Files, result.Bytes)
+	return result, nil
+}
+
+// purgeRemoteCaches removes every cache built from a remote record, with its cache_entries
+// records, e.g. after the remote was reconfigured or deleted
+func purgeRemoteCaches(app core.App, remoteID string) (*CachePurgeResult, error) {
+	records, err := app.FindRecordsByFilter("cache_entries", "rclone_remote = {:remote}", "", 0, 0,
+		map[string]any{"remote": remoteID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	result := &CachePurgeResult{}
+	for _, record := range records {
+		result.add(purgeCacheFile(app, record.GetString("cache_key"), record.GetString("cache_path")))
+	}
+	purgeArchives(app, records, result)
+	return result, nil
+}
+
+// purgeArchives removes the downloaded archives the given cache entries were extracted from
+// (see fetchArchive), so they are fetched again with the next request for one of their entries
+func purgeArchives(app core.App, records []*core.Record, result *CachePurgeResult) {
+	archiveDir := filepath.Join(app.DataDir(), "cache", "archives")
+	seen := map[string]bool{}
+	for _, record := range records {
+		archiveKey := record.GetString("archive_key")
+		if archiveKey == "" || seen[archiveKey] {
+			continue
+		}
+		seen[archiveKey] = true
+
+		matches, _ := filepath.Glob(filepath.Join(archiveDir, archiveKey+".*"))
+		for _, archiveFile := range matches {
+			if strings.HasSuffix(archiveFile, ".source.json") {
+				continue
+			}
+			if info, err := os.Stat(archiveFile); err == nil && os.Remove(archiveFile) == nil {
+				result.add(info.Size())
+				RemoveFingerprint(archiveFile)
+			}
+		}
+	}
+}
+
+// add counts a removed file; size is negative when nothing was removed
+func (r *CachePurgeResult) add(size int64) {
+	if size < 0 {
+		return
+	}
+	r.Files++
+	r.Bytes += size
+}
+
+// purgeCacheFile removes one cache database with its sidecars and manifest entry.
+// Returns the size of the removed database, or -1 if there was no file.
+func purgeCacheFile(app core.App, cacheKey, cachePath string) int64 {
+	size := int64(-1)
+	if cachePath != "" {
+		if info, err := os.Stat(cachePath); err == nil {
+			size = info.Size()
+		}
+		removeSQLiteFiles(cachePath)
+		RemoveFingerprint(cachePath)
+	}
+	if err := RemoveCacheEntry(app, cacheKey); err != nil {
+		log.Printf("[CACHE] Warning: failed to remove cache entry %s: %v", cacheKey, err)
+	}
+	return size
+}
+
+// ListCacheEntries returns the cache_entries records, most recently used first
+func ListCacheEntries(app core.App) ([]*core.Record, error) {
+	if err := FlushCacheHits(app); err != nil {
+		log.Printf("[CACHE] Warning: failed to flush cache hits: %v", err)
+	}
+	return app.FindRecordsByFilter("cache_entries", "", "-last_access", 0, 0)
+}
+
+// GetCacheStats measures pb_data/cache and sums up the manifest
+func GetCacheStats(app core.App) (*CacheStats, error) {
+	cacheDir := filepath.Join(app.DataDir(), "cache")
+	stats := &CacheStats{MaxBytes: GetCacheMaxSize(app)}
+
+	records, err := ListCacheEntries(app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+	stats.Entries = len(records)
+	for _, record := range records {
+		stats.Hits += record.GetInt("hit_count")
+	}
+
+	if entries, err := os.ReadDir(cacheDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".db" {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				stats.Files++
+				stats.Bytes += info.Size()
+			}
+		}
+	}
+
+	if stats.TotalBytes, err = dirSize(cacheDir); err != nil {
+		return nil, fmt.Errorf("failed to measure cache directory: %w", err)
+	}
+
+	cacheBuilds.mu.Lock()
+	stats.Building = len(cacheBuilds.calls)
+	cacheBuilds.mu.Unlock()
+
+	return stats, nil
+}
+
+// RegisterCacheRoutes adds the superuser-only cache administration API:
+//
+//	GET  /api/flight/cache        list cache_entries
+//	GET  /api/flight/cache/stats  cache size, quota and hit totals
+//	POST /api/flight/cache/purge  purge by {"url"}, {"remote", "prefix"} or {"all": true}
+func RegisterCacheRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/flight/cache")
+	g.Bind(apis.RequireSuperuserAuth())
+
+	g.GET("", func(e *core.RequestEvent) error {
+		records, err := ListCacheEntries(e.App)
+		if err != nil {
+			return apis.NewApiError(http.StatusInternalServerError, "Failed to list cache entries", err)
+		}
+		return e.JSON(http.StatusOK, records)
+	})
+
+	g.GET("/stats", func(e *core.RequestEvent) error {
+		stats, err := GetCacheStats(e.App)
+		if err != nil {
+			return apis.NewApiError(http.StatusInternalServerError, "Failed to read cache stats", err)
+		}
+		return e.JSON(http.StatusOK, stats)
+	})
+
+	g.POST("/purge", func(e *core.RequestEvent) error {
+		var purge CachePurge
+		if err := e.BindBody(&purge); err != nil {
+			return apis.NewBadRequestError("Invalid purge request", err)
+		}
+		result, err := PurgeCache(e.App, purge)
+		if errors.Is(err, ErrInvalidPurge) {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return apis.NewApiError(http.StatusInternalServerError, "Failed to purge cache", err)
+		}
+		return e.JSON(http.StatusOK, result)
+	})
+}
+
+// wantsRefresh reports whether the request asked to bypass the cache (?refresh=1)
+func wantsRefresh(e *core.RequestEvent) bool {
+	switch strings.ToLower(e.Request.URL.Query().Get("refresh")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package flight
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	rclonefs "github.com/rclone/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+// NewCacheCommand creates the `cache` command with the purge, ls and stats subcommands.
+// They work on pb_data directly, so the server does not need to be running.
+func NewCacheCommand(app core.App) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and purge the converted dataset cache",
+	}
+
+	// The server's OnServe hook is not run for commands; make sure cache_entries exists
+	ensure := func(cmd *cobra.Command, args []string) error {
+		return EnsureCollections(app)
+	}
+
+	var purge CachePurge
+	purgeCmd := &cobra.Command{
+		Use:   "purge [banquet URL]",
+		Short: "Remove cached databases for a URL, a remote/path prefix or everything",
+		Example: `  flight cache purge /s3:/sales/reports/today.csv
+  flight cache purge --remote sales --prefix reports/2026
+  flight cache purge --all`,
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: ensure,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				purge.URL = args[0]
+			}
+			result, err := PurgeCache(app, purge)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Purged %d cache files (%s)\n", result.Files, rclonefs.SizeSuffix(result.Bytes))
+			return nil
+		},
+	}
+	purgeCmd.Flags().StringVar(&purge.Remote, "remote", "", "purge all caches of this rclone_remotes name")
+	purgeCmd.Flags().StringVar(&purge.Prefix, "prefix", "", "only purge datasets below this path")
+	purgeCmd.Flags().BoolVar(&purge.All, "all", false, "purge the whole cache")
+
+	lsCmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List cached datasets, most recently used first",
+		Args:    cobra.NoArgs,
+		PreRunE: ensure,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := ListCacheEntries(app)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SIZE\tHITS\tLAST ACCESS\tCONVERTER\tSOURCE")
+			for _, record := range records {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+					rclonefs.SizeSuffix(record.GetInt("size_bytes")),
+					record.GetInt("hit_count"),
+					record.GetDateTime("last_access").Time().Local().Format(time.DateTime),
+					record.GetString("converter"),
+					record.GetString("source_url"),
+				)
+			}
+			return w.Flush()
+		},
+	}
+
+	statsCmd := &cobra.Command{
+		Use:     "stats",
+		Short:   "Show cache size, quota and hit totals",
+		Args:    cobra.NoArgs,
+		PreRunE: ensure,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats, err := GetCacheStats(app)
+			if err != nil {
+				return err
+			}
+
+			quota := "unlimited"
+			if stats.MaxBytes > 0 {
+				quota = rclonefs.SizeSuffix(stats.MaxBytes).String()
+			}
+			fmt.Printf("Entries:     %d\n", stats.Entries)
+			fmt.Printf("Databases:   %d (%s)\n", stats.Files, rclonefs.SizeSuffix(stats.Bytes))
+			fmt.Printf("Cache dir:   %s (quota %s)\n", rclonefs.SizeSuffix(stats.TotalBytes), quota)
+			fmt.Printf("Total hits:  %d\n", stats.Hits)
+			return nil
+		},
+	}
+
+	command.AddCommand(purgeCmd, lsCmd, statsCmd)
+	return command
+}
@@ -0,0 +1,305 @@
+package flight
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	rclonefs "github.com/rclone/rclone/fs"
+)
+
+const (
+	// cacheJanitorSchedule is how often the janitor enforces the cache quota
+	cacheJanitorSchedule = "*/10 * * * *"
+	// cacheEvictionGrace protects recently accessed entries: SQLiter keeps querying a
+	// database after HandleBanquet has returned the UI
+	cacheEvictionGrace = 10 * time.Minute
+	// tempMaxAge is the age after which unleased files in pb_data/temp are considered leftovers
+	tempMaxAge = time.Hour
+)
+
+// cacheLeases counts active users (builds and requests being served) per file path
+var cacheLeases = struct {
+	mu     sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// AcquireCache marks a cache or temp file as in use so the janitor never evicts it.
+// The returned function releases the lease and must be called exactly once.
+func AcquireCache(path string) func() {
+	cacheLeases.mu.Lock()
+	cacheLeases.counts[path]++
+	cacheLeases.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cacheLeases.mu.Lock()
+			defer cacheLeases.mu.Unlock()
+			if cacheLeases.counts[path] <= 1 {
+				delete(cacheLeases.counts, path)
+			} else {
+				cacheLeases.counts[path]--
+			}
+		})
+	}
+}
+
+// isCacheLeased reports whether a file is currently being built or served
+func isCacheLeased(path string) bool {
+	cacheLeases.mu.Lock()
+	defer cacheLeases.mu.Unlock()
+	return cacheLeases.counts[path] > 0
+}
+
+// GetCacheMaxSize returns the cache quota in bytes from the "cache_max_size" app setting.
+// Values use rclone size syntax ("500M", "10G"); 0 means unlimited.
+func GetCacheMaxSize(app core.App) int64 {
+	val := strings.TrimSpace(GetAppSetting(app, "cache_max_size"))
+	if val == "" {
+		return 0
+	}
+
+	var size rclonefs.SizeSuffix
+	if err := size.Set(val); err != nil {
+		log.Printf("[CACHE] Ignoring invalid app_settings cache_max_size %q: %v", val, err)
+		return 0
+	}
+	if size < 0 {
+		return 0
+	}
+	return int64(size)
+}
+
+// StartCacheJanitor schedules periodic quota enforcement of pb_data/cache, which also
+// writes buffered cache hits to cache_entries
+func StartCacheJanitor(app core.App) {
+	app.Cron().MustAdd("flight_cache_janitor", cacheJanitorSchedule, func() {
+		if _, err := EvictCache(app, GetCacheMaxSize(app)); err != nil {
+			log.Printf("[CACHE] Janitor error: %v", err)
+		}
+	})
+}
+
+// evictionCandidate is a converted database that may be removed to free space
+type evictionCandidate struct {
+	path       string
+	cacheKey   string
+	size       int64
+	lastAccess time.Time
+	archive    bool // downloaded archive in cache/archives, not a converted database
+}
+
+// EvictCache removes temp leftovers and partial builds, then least recently used converted databases
+// and archives until they fit in maxBytes. The rclone VFS cache below pb_data/cache is not counted:
+// the janitor cannot evict it (see vfs_idle_timeout). Databases that are leased (being built or served) or were accessed within the grace
+// period are never evicted. A maxBytes of 0 only cleans up temp leftovers.
+// Returns the number of bytes freed.
+func EvictCache(app core.App, maxBytes int64) (int64, error) {
+	cacheDir := filepath.Join(app.DataDir(), "cache")
+	tempDir := filepath.Join(app.DataDir(), "temp")
+
+	// Last access times decide what is evicted
+	if err := FlushCacheHits(app); err != nil {
+		log.Printf("[CACHE] Warning: failed to flush cache hits: %v", err)
+	}
+
+	CleanupStaleBuilds(cacheDir)
+	freed := cleanTempLeftovers(tempDir)
+
+	if maxBytes <= 0 {
+		return freed, nil
+	}
+
+	total, err := managedCacheSize(cacheDir)
+	if err != nil {
+		return freed, fmt.Errorf("failed to measure cache directory: %w", err)
+	}
+	if total <= maxBytes {
+		return freed, nil
+	}
+
+	log.Printf("[CACHE] Cache size %s exceeds quota %s, evicting least recently used entries",
+		rclonefs.SizeSuffix(total), rclonefs.SizeSuffix(maxBytes))
+
+	candidates, err := listEvictionCandidates(app, cacheDir)
+	if err != nil {
+		return freed, err
+	}
+
+	for _, c := range candidates {
+		if total <= maxBytes {
+			break
+		}
+		if isCacheLeased(c.path) || time.Since(c.lastAccess) < cacheEvictionGrace {
+			continue
+		}
+
+		if err := os.Remove(c.path); err != nil {
+			log.Printf("[CACHE] Warning: failed to evict %s: %v", c.path, err)
+			continue
+		}
+		RemoveFingerprint(c.path)
+		// An archive shares its key with its listing, whose manifest entry stays
+		if !c.archive {
+			removeSQLiteFiles(c.path) // journals SQLite left next to the database
+			if err := RemoveCacheEntry(app, c.cacheKey); err != nil {
+				log.Printf("[CACHE] Warning: failed to remove cache entry %s: %v", c.cacheKey, err)
+			}
+		}
+
+		total -= c.size
+		freed += c.size
+		log.Printf("[CACHE] Evicted %s (%s, last access %s)",
+			c.cacheKey, rclonefs.SizeSuffix(c.size), c.lastAccess.Format(time.RFC3339))
+	}
+
+	if total > maxBytes {
+		log.Printf("[CACHE] Warning: cache still %s over quota %s after eviction (entries in use)",
+			rclonefs.SizeSuffix(total), rclonefs.SizeSuffix(maxBytes))
+	}
+	return freed, nil
+}
+
+// listEvictionCandidates returns the converted databases in cacheDir and the archives kept in
+// cacheDir/archives, least recently used first. The last access comes from cache_entries when
+// recorded, otherwise from the file modification time (renewed on every use of an archive).
+func listEvictionCandidates(app core.App, cacheDir string) ([]evictionCandidate, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var candidates []evictionCandidate
+	archiveDir := filepath.Join(cacheDir, "archives")
+	archives, _ := os.ReadDir(archiveDir)
+	for _, entry := range archives {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".source.json") || strings.HasSuffix(name, ".download") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			candidates = append(candidates, evictionCandidate{
+				path:       filepath.Join(archiveDir, name),
+				cacheKey:   strings.TrimSuffix(name, sourceExt(name)),
+				size:       info.Size(),
+				lastAccess: info.ModTime(),
+				archive:    true,
+			})
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".db" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		c := evictionCandidate{
+			path:       filepath.Join(cacheDir, entry.Name()),
+			cacheKey:   strings.TrimSuffix(entry.Name(), ".db"),
+			size:       info.Size(),
+			lastAccess: info.ModTime(),
+		}
+		// Journals and the fingerprint sidecar go with the database
+		for _, suffix := range []string{"-journal", "-wal", "-shm", ".source.json"} {
+			if info, err := os.Stat(c.path + suffix); err == nil {
+				c.size += info.Size()
+			}
+		}
+		if record, err := app.FindFirstRecordByData("cache_entries", "cache_key", c.cacheKey); err == nil && record != nil {
+			if last := record.GetDateTime("last_access"); !last.IsZero() {
+				c.lastAccess = last.Time()
+			}
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastAccess.Before(candidates[j].lastAccess)
+	})
+	return candidates, nil
+}
+
+// cleanTempLeftovers removes files in pb_data/temp left behind by interrupted fetches.
+// Returns the number of bytes freed.
+func cleanTempLeftovers(tempDir string) int64 {
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return 0
+	}
+
+	var freed int64
+	for _, entry := range entries {
+		path := filepath.Join(tempDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < tempMaxAge || isCacheLeased(path) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("[CACHE] Warning: failed to remove temp leftover %s: %v", path, err)
+			continue
+		}
+		freed += info.Size()
+		log.Printf("[CACHE] Removed temp leftover %s", entry.Name())
+	}
+	return freed
+}
+
+// managedCacheSize returns the size of what the janitor manages in cacheDir: the files
+// directly in it (converted databases, their journals and sidecars) and the archives
+func managedCacheSize(cacheDir string) (int64, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+
+	archives, err := dirSize(filepath.Join(cacheDir, "archives"))
+	return total + archives, err
+}
+
+// dirSize returns the total size of all regular files below dir
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,339 @@
+package flight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/darianmavgo/mksqlite/converters"
+	"github.com/darianmavgo/mksqlite/converters/common"
+)
+
+// columnarBatchSize is how many rows are decoded at a time, so large Parquet and Arrow
+// files convert without being loaded into memory
+const columnarBatchSize = 64 * 1024
+
+// Magic numbers of the columnar formats, both at the start of the file
+var (
+	magicParquet  = []byte("PAR1")
+	magicArrowIPC = []byte("ARROW1") // IPC file format (Feather v2); the stream format has none
+)
+
+func init() {
+	converters.Register("parquet", &parquetDriver{})
+	converters.Register("arrow", &arrowDriver{})
+}
+
+// readAtSeeker is the random access Parquet and the Arrow IPC file format need
+type readAtSeeker interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// randomAccessSource returns source itself when it supports random access (a plain source
+// file, see ConvertSource), otherwise its content read into memory
+func randomAccessSource(source io.Reader, driver string) (readAtSeeker, error) {
+	if ras, ok := source.(readAtSeeker); ok {
+		return ras, nil
+	}
+	log.Printf("[CONVERTER] Warning: %s source is not seekable, reading it into memory", driver)
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// batchReader iterates the record batches of a columnar source
+type batchReader interface {
+	Next() bool
+	RecordBatch() arrow.RecordBatch
+	Err() error
+	Release()
+}
+
+// parquetDriver converts Parquet files, decoding them row group by row group
+type parquetDriver struct{}
+
+// Open implements common.Driver
+func (d *parquetDriver) Open(source io.Reader, config *common.ConversionConfig) (common.RowProvider, error) {
+	ras, err := randomAccessSource(source, "parquet")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet source: %w", err)
+	}
+
+	// Not closed: the source belongs to the caller
+	pf, err := file.NewParquetReader(ras)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: columnarBatchSize}, memory.DefaultAllocator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet schema: %w", err)
+	}
+	schema, err := reader.Schema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet schema: %w", err)
+	}
+
+	log.Printf("[CONVERTER] Parquet file with %d rows in %d row groups", pf.NumRows(), pf.NumRowGroups())
+	return newColumnarProvider(schema, config, func() (batchReader, error) {
+		return reader.GetRecordReader(context.Background(), nil, nil)
+	}), nil
+}
+
+// arrowDriver converts Arrow IPC data, both the file format (.arrow, .feather) and the
+// stream format (.arrows)
+type arrowDriver struct{}
+
+// Open implements common.Driver
+func (d *arrowDriver) Open(source io.Reader, config *common.ConversionConfig) (common.RowProvider, error) {
+	br := bufio.NewReader(source)
+	magic, _ := br.Peek(len(magicArrowIPC))
+	if !bytes.Equal(magic, magicArrowIPC) {
+		reader, err := ipc.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open arrow stream: %w", err)
+		}
+		return newColumnarProvider(reader.Schema(), config, func() (batchReader, error) {
+			return reader, nil
+		}), nil
+	}
+
+	// The file format keeps its footer at the end; read it through the original source
+	if seeker, ok := source.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind arrow file: %w", err)
+		}
+	} else {
+		source = br
+	}
+	ras, err := randomAccessSource(source, "arrow")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read arrow source: %w", err)
+	}
+	reader, err := ipc.NewFileReader(ras)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open arrow file: %w", err)
+	}
+	return newColumnarProvider(reader.Schema(), config, func() (batchReader, error) {
+		return &ipcFileBatches{reader: reader}, nil
+	}), nil
+}
+
+// ipcFileBatches iterates the record batches of an Arrow IPC file
+type ipcFileBatches struct {
+	reader *ipc.FileReader
+	next   int
+	batch  arrow.RecordBatch
+	err    error
+}
+
+func (b *ipcFileBatches) Next() bool {
+	if b.batch != nil {
+		b.batch.Release()
+		b.batch = nil
+	}
+	if b.err != nil || b.next >= b.reader.NumRecords() {
+		return false
+	}
+	b.batch, b.err = b.reader.RecordBatchAt(b.next)
+	b.next++
+	return b.err == nil
+}
+
+func (b *ipcFileBatches) RecordBatch() arrow.RecordBatch { return b.batch }
+func (b *ipcFileBatches) Err() error                     { return b.err }
+
+func (b *ipcFileBatches) Release() {
+	if b.batch != nil {
+		b.batch.Release()
+	}
+	b.reader.Close()
+}
+
+// columnarProvider serves a columnar source as a single table typed after its schema
+type columnarProvider struct {
+	table   string
+	schema  *arrow.Schema
+	headers []string
+	open    func() (batchReader, error)
+}
+
+func newColumnarProvider(schema *arrow.Schema, config *common.ConversionConfig, open func() (batchReader, error)) *columnarProvider {
+	table := "tb0"
+	if config != nil && config.TableName != "" {
+		table = config.TableName
+	}
+
+	names := make([]string, schema.NumFields())
+	for i, field := range schema.Fields() {
+		names[i] = field.Name
+	}
+	return &columnarProvider{
+		table:   table,
+		schema:  schema,
+		headers: common.GenColumnNames(names),
+		open:    open,
+	}
+}
+
+func (p *columnarProvider) GetTableNames() []string {
+	return []string{p.table}
+}
+
+func (p *columnarProvider) GetHeaders(tableName string) []string {
+	if tableName != p.table {
+		return nil
+	}
+	return p.headers
+}
+
+// GetColumnTypes implements columnTyper with the SQLite types of the schema's fields
+func (p *columnarProvider) GetColumnTypes(tableName string) []string {
+	if tableName != p.table {
+		return nil
+	}
+	types := make([]string, p.schema.NumFields())
+	for i, field := range p.schema.Fields() {
+		types[i] = arrowSQLiteType(field.Type)
+	}
+	return types
+}
+
+func (p *columnarProvider) ScanRows(tableName string, yield func([]interface{}, error) error) error {
+	if tableName != p.table {
+		return fmt.Errorf("unknown table %s", tableName)
+	}
+
+	reader, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	for reader.Next() {
+		batch := reader.RecordBatch()
+		columns := batch.Columns()
+		for i := 0; i < int(batch.NumRows()); i++ {
+			row := make([]interface{}, len(columns))
+			for c, col := range columns {
+				row[c] = arrowValue(col, i)
+			}
+			if err := yield(row, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if err := reader.Err(); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read record batch: %w", err)
+	}
+	return nil
+}
+
+// arrowSQLiteType maps an Arrow type to the SQLite column type it is stored as
+func arrowSQLiteType(dt arrow.DataType) string {
+	switch dt.ID() {
+	case arrow.BOOL, arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return "INTEGER"
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return "REAL"
+	case arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return "DATETIME"
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+		return "BLOB"
+	case arrow.DICTIONARY:
+		return arrowSQLiteType(dt.(*arrow.DictionaryType).ValueType)
+	}
+	return "TEXT"
+}
+
+// arrowValue returns the value at row i of col as stored in SQLite: integers, floats,
+// text, blobs, decimals as exact text, timestamps as RFC 3339 text and nested values as JSON
+func arrowValue(col arrow.Array, i int) interface{} {
+	if col.IsNull(i) {
+		return nil
+	}
+
+	switch a := col.(type) {
+	case *array.Boolean:
+		if a.Value(i) {
+			return int64(1)
+		}
+		return int64(0)
+	case *array.Int8:
+		return int64(a.Value(i))
+	case *array.Int16:
+		return int64(a.Value(i))
+	case *array.Int32:
+		return int64(a.Value(i))
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Uint8:
+		return int64(a.Value(i))
+	case *array.Uint16:
+		return int64(a.Value(i))
+	case *array.Uint32:
+		return int64(a.Value(i))
+	case *array.Uint64:
+		if v := a.Value(i); v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return a.ValueStr(i)
+	case *array.Float16:
+		return float64(a.Value(i).Float32())
+	case *array.Float32:
+		return float64(a.Value(i))
+	case *array.Float64:
+		return a.Value(i)
+	case *array.Decimal128:
+		// Exact text, amounts with more digits than a float holds must not be rounded
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Binary:
+		return bytes.Clone(a.Value(i))
+	case *array.LargeBinary:
+		return bytes.Clone(a.Value(i))
+	case *array.FixedSizeBinary:
+		return bytes.Clone(a.Value(i))
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return a.Value(i).ToTime(unit).UTC().Format(time.RFC3339Nano)
+	case *array.Date32:
+		return a.Value(i).ToTime().Format(time.DateOnly)
+	case *array.Date64:
+		return a.Value(i).ToTime().Format(time.DateOnly)
+	case *array.Dictionary:
+		return arrowValue(a.Dictionary(), a.GetValueIndex(i))
+	}
+
+	// Lists, structs, maps and anything else: JSON text
+	v := col.GetOneForMarshal(i)
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return col.ValueStr(i)
+	}
+	return string(data)
+}
@@ -0,0 +1,251 @@
+package flight
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compression is a single-file compression format decoded in front of the converters,
+// so data.csv.gz converts like data.csv
+type compression struct {
+	name  string
+	exts  []string
+	magic []byte
+	open  func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = []compression{
+	{
+		name:  "gzip",
+		exts:  []string{".gz", ".gzip", ".tgz"},
+		magic: []byte{0x1F, 0x8B},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		name:  "bzip2",
+		exts:  []string{".bz2"},
+		magic: []byte("BZh"), // followed by the block size digit, checked in detectCompression
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+	{
+		name:  "zstd",
+		exts:  []string{".zst", ".zstd"},
+		magic: []byte{0x28, 0xB5, 0x2F, 0xFD},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			dec, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return dec.IOReadCloser(), nil
+		},
+	},
+	{
+		name:  "xz",
+		exts:  []string{".xz"},
+		magic: []byte{0xFD, '7', 'z', 'X', 'Z', 0x00},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			dec, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(dec), nil
+		},
+	},
+}
+
+// compressionContentTypes are media types that only say a source is compressed. They tell
+// nothing about the inner format and are ignored when detecting its driver.
+var compressionContentTypes = map[string]bool{
+	"application/gzip":    true,
+	"application/x-gzip":  true,
+	"application/x-bzip2": true,
+	"application/zstd":    true,
+	"application/x-xz":    true,
+}
+
+// detectCompression recognises a compressed source by its magic bytes, which are conclusive.
+// The extension alone is not trusted: HTTP servers often decode .gz downloads on the fly.
+func detectCompression(sample []byte) *compression {
+	for i := range compressions {
+		c := &compressions[i]
+		if !bytes.HasPrefix(sample, c.magic) {
+			continue
+		}
+		if c.name == "bzip2" && (len(sample) < 4 || sample[3] < '1' || sample[3] > '9') {
+			continue
+		}
+		return c
+	}
+	return nil
+}
+
+// compressionExt returns the compression extension of a name (".gz", ".zst", ...), "" if none
+func compressionExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, c := range compressions {
+		for _, e := range c.exts {
+			if ext == e {
+				return ext
+			}
+		}
+	}
+	return ""
+}
+
+// compressedAliases are single extensions that stand for a compressed inner format
+var compressedAliases = map[string]string{
+	".tgz": ".tar",
+}
+
+// trimCompressionExt removes a compression extension: "data.csv.gz" becomes "data.csv"
+// and "bundle.tgz" becomes "bundle.tar"
+func trimCompressionExt(name string) string {
+	if ext := compressionExt(name); ext != "" {
+		return name[:len(name)-len(ext)] + compressedAliases[ext]
+	}
+	return name
+}
+
+// sourceExt returns the extension a downloaded copy of a source needs to keep its format
+// recognisable: ".csv" for data.csv, ".csv.gz" for data.csv.gz
+func sourceExt(name string) string {
+	ext := compressionExt(name)
+	switch {
+	case ext == "":
+		return filepath.Ext(name)
+	case compressedAliases[ext] != "":
+		return ext
+	}
+	return filepath.Ext(trimCompressionExt(name)) + ext
+}
+
+// sourceStream is a source opened for conversion, either a local file or a stream such as a
+// VFS handle. Compressed sources are decoded on the fly; detection then runs on the
+// decompressed content and the inner file name.
+type sourceStream struct {
+	*bufio.Reader
+	file        *os.File // the plain (uncompressed) source file, nil for streams and compressed sources
+	name        string   // file name without its compression extension, for extension matching
+	contentType string   // reported Content-Type, "" when it only described the compression
+	compression string   // "gzip", "bzip2", "zstd", "xz" or "" for plain sources
+	sample      []byte   // first sniffLen bytes of the (decompressed) content
+	closers     []io.Closer
+}
+
+// openSource opens a source file for conversion, decompressing it when needed
+func openSource(path, contentType string) (*sourceStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	s, err := newSourceStream(file, path, contentType)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.closers = append([]io.Closer{file}, s.closers...)
+	if s.compression == "" {
+		s.file = file
+	}
+	return s, nil
+}
+
+// newSourceStream wraps a source read from r, decompressing it when needed. name is the
+// source's file name, used for extension matching. Closing the stream closes the
+// decompressor but not r.
+func newSourceStream(r io.Reader, name, contentType string) (*sourceStream, error) {
+	s := &sourceStream{
+		name:        trimCompressionExt(name),
+		contentType: contentType,
+	}
+
+	br := bufio.NewReaderSize(r, sniffLen)
+	sample, err := peekSample(br)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+
+	if c := detectCompression(sample); c != nil {
+		dec, err := c.open(br)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to open %s stream: %w", c.name, err)
+		}
+		s.closers = append(s.closers, dec)
+		s.compression = c.name
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && compressionContentTypes[strings.ToLower(mediaType)] {
+			s.contentType = ""
+		}
+		log.Printf("[CONVERTER] Decompressing %s source", c.name)
+
+		br = bufio.NewReaderSize(dec, sniffLen)
+		if sample, err = peekSample(br); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to decompress source: %w", err)
+		}
+	}
+
+	s.Reader = br
+	s.sample = sample
+	return s, nil
+}
+
+// peekSample returns up to sniffLen bytes without consuming them
+func peekSample(br *bufio.Reader) ([]byte, error) {
+	sample, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// detectDriver runs DetectDriver's checks on the (decompressed) content
+func (s *sourceStream) detectDriver() (string, error) {
+	zipIsXLSX := func() bool { return isXLSX(s.file.Name()) }
+	if s.file == nil {
+		// No random access into a stream; workbook parts are named in the local headers
+		zipIsXLSX = func() bool { return bytes.Contains(s.sample, []byte("xl/")) }
+	}
+	return detectDriver(s.name, s.sample, s.contentType, zipIsXLSX)
+}
+
+// randomAccess returns the source file rewound to its start for drivers that read the ZIP
+// central directory, nil when the source is a stream or compressed
+func (s *sourceStream) randomAccess() *os.File {
+	if s.file == nil {
+		return nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	return s.file
+}
+
+// Close closes the decompressor and the source file, if opened by openSource
+func (s *sourceStream) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
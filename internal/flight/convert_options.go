@@ -0,0 +1,301 @@
+package flight
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/darianmavgo/mksqlite/converters/common"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ConvertOptions carries a mksqlite_configs record into a conversion.
+// A nil *ConvertOptions converts with DetectDriver and mksqlite defaults.
+type ConvertOptions struct {
+	Name   string         // mksqlite_configs name, for logging
+	Driver string         // mksqlite driver overriding DetectDriver, e.g. "csv"
+	Args   map[string]any // driver arguments, see below
+
+	// ContentType is the media type the source reported when it was fetched (e.g. the
+	// HTTP Content-Type header). It feeds DetectDriver and is not part of Hash.
+	ContentType string
+}
+
+// Supported mksqlite_configs args:
+//
+//	delimiter                  field separator, e.g. ";" or "\t" (CSV; detected when unset)
+//	header                     false for files without a header row (CSV)
+//	columns                    column names for header-less files (CSV; default column1..N)
+//	table_name                 name of the resulting table
+//	advanced_header_detection  look for the header row among the first rows (CSV)
+//	flatten_depth              levels of nested objects flattened into dotted columns, deeper
+//	                           ones are kept as JSON text (NDJSON; default all, 0 for none)
+//	array_tables               true to spill arrays into child tables keyed by the parent
+//	                           row's _id instead of JSON text (NDJSON)
+//	infer_types                true to retype TEXT columns as INTEGER, REAL or DATETIME when
+//	                           all sampled values parse (see inferColumnTypes)
+//	infer_sample               non-empty values per column sampled by infer_types (default 1000)
+//	fts                        true to build a full-text search index over the TEXT columns
+//	                           of every table, searched with ?q= (see buildSearchIndex)
+//	verbose                    detailed converter logging
+var convertArgs = map[string]bool{
+	"delimiter":                 true,
+	"header":                    true,
+	"columns":                   true,
+	"table_name":                true,
+	"advanced_header_detection": true,
+	"flatten_depth":             true,
+	"array_tables":              true,
+	"infer_types":               true,
+	"infer_sample":              true,
+	"fts":                       true,
+	"verbose":                   true,
+}
+
+// ResolveConvertOptions returns the conversion options for a dataset: the mksqlite_config of
+// the matching data_pipeline, else a mksqlite_configs record listing the file extension in
+// its extensions field (the inner one for compressed files), else nil.
+func ResolveConvertOptions(app core.App, remoteRecord *core.Record, datasetPath string) *ConvertOptions {
+	if pipeline := FindPipeline(app, remoteRecord, datasetPath); pipeline != nil {
+		if configID := pipeline.GetString("mksqlite_config"); configID != "" {
+			if record, err := app.FindRecordById("mksqlite_configs", configID); err == nil {
+				return convertOptionsFromRecord(record)
+			}
+			log.Printf("[CONVERTER] Warning: mksqlite_config %s of pipeline %s not found", configID, pipeline.GetString("name"))
+		}
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(trimCompressionExt(datasetPath))), ".")
+	if ext == "" {
+		return nil
+	}
+
+	records, err := app.FindRecordsByFilter("mksqlite_configs", "extensions ~ {:ext}", "", 0, 0,
+		map[string]any{"ext": ext})
+	if err != nil {
+		return nil
+	}
+	for _, record := range records {
+		for _, listed := range strings.FieldsFunc(strings.ToLower(record.GetString("extensions")), func(r rune) bool {
+			return r == ',' || r == ' '
+		}) {
+			if strings.TrimPrefix(listed, ".") == ext {
+				return convertOptionsFromRecord(record)
+			}
+		}
+	}
+	return nil
+}
+
+// convertOptionsFromRecord reads the driver and args of a mksqlite_configs record
+func convertOptionsFromRecord(record *core.Record) *ConvertOptions {
+	opts := &ConvertOptions{
+		Name:   record.GetString("name"),
+		Driver: strings.ToLower(strings.TrimSpace(record.GetString("driver"))),
+	}
+	if err := record.UnmarshalJSONField("args", &opts.Args); err != nil {
+		log.Printf("[CONVERTER] Warning: ignoring invalid args of mksqlite_config %s: %v", opts.Name, err)
+		opts.Args = nil
+	}
+	for key := range opts.Args {
+		if !convertArgs[key] {
+			log.Printf("[CONVERTER] Warning: mksqlite_config %s has unknown arg %q", opts.Name, key)
+		}
+	}
+	return opts
+}
+
+// Hash identifies the options a cache was built with, so changing a mksqlite_config
+// invalidates caches even when the source is unchanged. Empty for nil options.
+func (o *ConvertOptions) Hash() string {
+	if o == nil || (o.Driver == "" && len(o.Args) == 0) {
+		return ""
+	}
+	data, _ := json.Marshal(struct {
+		Driver string         `json:"driver"`
+		Args   map[string]any `json:"args"`
+	}{o.Driver, o.Args}) // map keys are marshalled sorted
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// WithContentType returns a copy of the options (or empty options for nil) carrying the
+// Content-Type reported by the source
+func (o *ConvertOptions) WithContentType(contentType string) *ConvertOptions {
+	var copied ConvertOptions
+	if o != nil {
+		copied = *o
+	}
+	copied.ContentType = contentType
+	return &copied
+}
+
+// contentType returns the source's Content-Type, "" if unknown
+func (o *ConvertOptions) contentType() string {
+	if o == nil {
+		return ""
+	}
+	return o.ContentType
+}
+
+// conversionConfig maps the args onto a mksqlite ConversionConfig
+func (o *ConvertOptions) conversionConfig() (*common.ConversionConfig, error) {
+	config := &common.ConversionConfig{}
+	if o == nil {
+		return config, nil
+	}
+
+	if val, ok := o.Args["delimiter"]; ok {
+		delimiter, err := parseDelimiter(fmt.Sprint(val))
+		if err != nil {
+			return nil, err
+		}
+		config.Delimiter = delimiter
+	}
+	if val, ok := o.Args["table_name"].(string); ok {
+		config.TableName = val
+	}
+	config.AdvancedHeaderDetection = o.boolArg("advanced_header_detection", false)
+	config.Verbose = o.boolArg("verbose", false)
+	return config, nil
+}
+
+// headerless reports whether the source has no header row, and the column names to use
+func (o *ConvertOptions) headerless() (bool, []string) {
+	if o == nil {
+		return false, nil
+	}
+
+	var columns []string
+	if list, ok := o.Args["columns"].([]any); ok {
+		for _, c := range list {
+			columns = append(columns, fmt.Sprint(c))
+		}
+	}
+	return !o.boolArg("header", true) || len(columns) > 0, columns
+}
+
+// defaultInferSample is how many values per column infer_types looks at by default
+const defaultInferSample = 1000
+
+// inferSample returns the number of values sampled per column for type inference, 0 when
+// infer_types is off
+func (o *ConvertOptions) inferSample() int {
+	if o == nil || !o.boolArg("infer_types", false) {
+		return 0
+	}
+	if n, ok := o.intArg("infer_sample"); ok && n > 0 {
+		return n
+	}
+	return defaultInferSample
+}
+
+// searchIndex reports whether the fts arg asks for a full-text search index
+func (o *ConvertOptions) searchIndex() bool {
+	return o != nil && o.boolArg("fts", false)
+}
+
+// intArg reads an integer arg, accepting JSON numbers and numeric strings
+func (o *ConvertOptions) intArg(key string) (int, bool) {
+	switch val := o.Args[key].(type) {
+	case float64:
+		return int(val), true
+	case int:
+		return val, true
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(val)); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// boolArg reads a boolean arg, accepting JSON booleans and "true"/"false" strings
+func (o *ConvertOptions) boolArg(key string, def bool) bool {
+	switch val := o.Args[key].(type) {
+	case bool:
+		return val
+	case string:
+		switch strings.ToLower(val) {
+		case "true", "1", "yes":
+			return true
+		case "false", "0", "no":
+			return false
+		}
+	}
+	return def
+}
+
+// parseDelimiter accepts a single character or the names/escapes of common separators
+func parseDelimiter(val string) (rune, error) {
+	switch strings.ToLower(val) {
+	case `\t`, "tab", "\t":
+		return '\t', nil
+	case "space", " ":
+		return ' ', nil
+	case "comma":
+		return ',', nil
+	case "semicolon":
+		return ';', nil
+	case "pipe":
+		return '|', nil
+	}
+
+	runes := []rune(val)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("invalid delimiter %q: must be a single character", val)
+	}
+	return runes[0], nil
+}
+
+// withSyntheticHeader prepends a header row to a header-less CSV stream. Names come from
+// columns, padded with column1..N to the field count of the first row. The delimiter is
+// detected from the first row when not set; the one used is returned.
+func withSyntheticHeader(r io.Reader, delimiter rune, columns []string) (io.Reader, rune, error) {
+	br := bufio.NewReaderSize(r, 65536)
+	peek, _ := br.Peek(65536)
+	firstLine := string(peek)
+	if idx := strings.IndexAny(firstLine, "\r\n"); idx != -1 {
+		firstLine = firstLine[:idx]
+	}
+
+	if delimiter == 0 {
+		delimiter = common.DetectDelimiter(firstLine)
+	}
+
+	reader := csv.NewReader(strings.NewReader(firstLine))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	fields, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return nil, delimiter, fmt.Errorf("failed to read first row: %w", err)
+	}
+
+	header := make([]string, len(fields))
+	for i := range header {
+		if i < len(columns) && columns[i] != "" {
+			header[i] = columns[i]
+		} else {
+			header[i] = fmt.Sprintf("column%d", i+1)
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+	if err := writer.Write(header); err != nil {
+		return nil, delimiter, err
+	}
+	writer.Flush()
+
+	return io.MultiReader(&buf, br), delimiter, nil
+}
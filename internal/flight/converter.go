@@ -1,11 +1,12 @@
 package flight
 
 import (
+	"database/sql"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/darianmavgo/mksqlite/converters"
 	"github.com/darianmavgo/mksqlite/converters/common"
@@ -21,99 +22,224 @@ import (
 	_ "github.com/darianmavgo/mksqlite/converters/zip"
 )
 
+// ConvertResult describes how a source was turned into a SQLite database
+type ConvertResult struct {
+	Driver string // mksqlite driver used, or "sqlite" when the source was copied as-is
+}
+
 // ConvertToSQLite converts a source file or directory to SQLite database using mksqlite library
 func ConvertToSQLite(sourcePath, destPath string) error {
+	_, err := ConvertSource(sourcePath, destPath, nil)
+	return err
+}
+
+// ConvertSource is ConvertToSQLite with the driver and arguments of a mksqlite_config
+// (see ResolveConvertOptions; nil for defaults) that also reports which converter was used
+func ConvertSource(sourcePath, destPath string, opts *ConvertOptions) (*ConvertResult, error) {
 	log.Printf("[CONVERTER] Converting %s -> %s", sourcePath, destPath)
+	if opts != nil && opts.Name != "" {
+		log.Printf("[CONVERTER] Using mksqlite_config %s", opts.Name)
+	}
+
+	config, err := opts.conversionConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid mksqlite_config %s: %w", opts.Name, err)
+	}
 
 	// Check if source exists
 	fileInfo, err := os.Stat(sourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to stat source: %w", err)
+		return nil, fmt.Errorf("failed to stat source: %w", err)
 	}
 
 	// Ensure destination directory exists
 	destDir := filepath.Dir(destPath)
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
-	// Determine driver name based on file type
-	var driverName string
+	if !fileInfo.IsDir() {
+		// File - opened as a stream, decompressed when gzip/bzip2/zstd/xz compressed
+		src, err := openSource(sourcePath, opts.contentType())
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+		return convertStream(src, destPath, config, opts)
+	}
 
-	if fileInfo.IsDir() {
-		// Directory - use filesystem converter
-		driverName = "filesystem"
-		log.Printf("[CONVERTER] Using filesystem converter for directory")
-	} else {
-		// File - detect type from extension
-		ext := strings.ToLower(filepath.Ext(sourcePath))
+	// Directory - use filesystem converter
+	log.Printf("[CONVERTER] Using filesystem converter for directory")
 
-		switch ext {
-		case ".db", ".sqlite", ".sqlite3":
-			// Already SQLite, just copy
-			log.Printf("[CONVERTER] Source is already SQLite, copying")
-			return copyFile(sourcePath, destPath)
+	// The filesystem converter needs the directory path in InputPath
+	config.InputPath = sourcePath
+	provider, err := converters.Open("filesystem", nil, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open converter: %w", err)
+	}
+	return importProvider(listingProvider{provider}, "filesystem", destPath, opts)
+}
 
-		case ".csv":
-			driverName = "csv"
+// randomAccessDrivers read their source through a ZIP central directory or a file footer
+// and cannot convert from a stream
+var randomAccessDrivers = map[string]bool{
+	"excel":   true,
+	"zip":     true,
+	"parquet": true,
+	"arrow":   true,
+}
 
-		case ".xlsx", ".xls":
-			driverName = "excel"
+// ConvertReader converts a source read from r, such as an open VFS handle, without copying
+// it to disk first. name is the source's file name, used like the extension in DetectDriver.
+// Sources whose driver needs random access (XLSX, ZIP, Parquet, Arrow) are spooled into tempDir and
+// converted from there; SQLite sources are copied with a streaming io.Copy.
+func ConvertReader(r io.Reader, name, destPath, tempDir string, opts *ConvertOptions) (*ConvertResult, error) {
+	log.Printf("[CONVERTER] Converting stream %s -> %s", name, destPath)
+	if opts != nil && opts.Name != "" {
+		log.Printf("[CONVERTER] Using mksqlite_config %s", opts.Name)
+	}
+
+	config, err := opts.conversionConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid mksqlite_config %s: %w", opts.Name, err)
+	}
 
-		case ".html", ".htm":
-			driverName = "html"
+	src, err := newSourceStream(r, name, opts.contentType())
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
 
-		case ".json":
-			driverName = "json"
+	driverName, err := src.driver(opts)
+	if err != nil {
+		return nil, err
+	}
+	if !randomAccessDrivers[driverName] {
+		return convertStream(src, destPath, config, opts)
+	}
 
-		case ".md", ".markdown":
-			driverName = "markdown"
+	// Spool the (decompressed) content under the inner name and convert the file
+	log.Printf("[CONVERTER] %s needs random access, spooling to a temp file", driverName)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	spool, err := os.CreateTemp(tempDir, "spool-*"+filepath.Ext(src.name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	release := AcquireCache(spool.Name())
+	defer release()
+	defer os.Remove(spool.Name())
 
-		case ".txt":
-			driverName = "txt"
+	_, err = io.Copy(spool, src)
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool source: %w", err)
+	}
+	return ConvertSource(spool.Name(), destPath, opts)
+}
 
-		case ".zip":
-			driverName = "zip"
+// driver returns the mksqlite_config's driver, else the one detected from content,
+// Content-Type and extension
+func (s *sourceStream) driver(opts *ConvertOptions) (string, error) {
+	if opts != nil && opts.Driver != "" {
+		return opts.Driver, nil
+	}
+	return s.detectDriver()
+}
 
-		default:
-			return fmt.Errorf("unsupported file type: %s", ext)
-		}
+// convertStream converts an opened source into destPath
+func convertStream(src *sourceStream, destPath string, config *common.ConversionConfig, opts *ConvertOptions) (*ConvertResult, error) {
+	driverName, err := src.driver(opts)
+	if err != nil {
+		return nil, err
+	}
 
-		log.Printf("[CONVERTER] Using %s converter", driverName)
+	if driverName == "sqlite" {
+		// Already SQLite, just copy
+		return copySQLite(src, destPath, opts)
 	}
 
-	// Open the source file or directory
-	var provider common.RowProvider
+	log.Printf("[CONVERTER] Using %s converter", driverName)
 
-	if fileInfo.IsDir() {
-		// For directories, use the filesystem converter directly
-		// The filesystem converter needs the directory path in InputPath
-		provider, err = converters.Open(driverName, nil, &common.ConversionConfig{
-			InputPath: sourcePath,
-		})
-	} else {
-		// For files, open as io.Reader
-		file, err := os.Open(sourcePath)
-		if err != nil {
-			return fmt.Errorf("failed to open source file: %w", err)
+	var reader io.Reader = src
+	if randomAccessDrivers[driverName] {
+		if file := src.randomAccess(); file != nil {
+			// Lets the driver read the central directory or footer instead of copying the file
+			reader = file
 		}
-		defer file.Close()
+	}
+	if headerless, columns := opts.headerless(); headerless {
+		if driverName != "csv" {
+			log.Printf("[CONVERTER] Warning: header/columns args only apply to the csv driver, ignored for %s", driverName)
+		} else if reader, config.Delimiter, err = withSyntheticHeader(src, config.Delimiter, columns); err != nil {
+			return nil, fmt.Errorf("failed to read header-less source: %w", err)
+		}
+	}
 
-		provider, err = converters.Open(driverName, file, nil)
+	provider, err := converters.Open(driverName, reader, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open converter: %w", err)
 	}
+	if applier, ok := provider.(argsApplier); ok {
+		applier.applyArgs(opts)
+	}
+	return importProvider(provider, driverName, destPath, opts)
+}
 
+// importProvider writes the rows of an opened converter into destPath, inferring column
+// types and building the search index afterwards when the options ask for it
+func importProvider(provider common.RowProvider, driverName, destPath string, opts *ConvertOptions) (*ConvertResult, error) {
+	// Convert into a temp sibling and only publish a complete, verified database
+	err := publishAtomically(destPath, func(tmpPath string) error {
+		if err := importRows(provider, tmpPath); err != nil {
+			return err
+		}
+		if sample := opts.inferSample(); sample > 0 {
+			if err := inferColumnTypes(tmpPath, sample); err != nil {
+				return err
+			}
+		}
+		if opts.searchIndex() {
+			// After inference, so only columns that stayed TEXT are indexed
+			return buildSearchIndex(tmpPath)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to open converter: %w", err)
+		return nil, err
 	}
 
-	// Create output database file
-	dbFile, err := os.Create(destPath)
+	log.Printf("[CONVERTER] Conversion successful")
+	return &ConvertResult{Driver: driverName}, nil
+}
+
+// importRows writes the tables of provider into a new database at dbPath
+func importRows(provider common.RowProvider, dbPath string) error {
+	if typer, ok := provider.(columnTyper); ok {
+		// Column types from the source's schema
+		return importTyped(provider, typer, dbPath)
+	}
+	if importer, ok := provider.(streamImporter); ok {
+		db, err := sql.Open("sqlite", dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to open output database: %w", err)
+		}
+		defer db.Close()
+		if err := importer.ImportTo(db); err != nil {
+			return fmt.Errorf("conversion failed: %w", err)
+		}
+		return nil
+	}
+
+	dbFile, err := os.Create(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output database: %w", err)
 	}
 	defer dbFile.Close()
 
-	// Convert to SQLite
 	opts := &converters.ImportOptions{
 		Verbose: true,
 	}
@@ -121,16 +247,68 @@ func ConvertToSQLite(sourcePath, destPath string) error {
 	if err := converters.ImportToSQLite(provider, dbFile, opts); err != nil {
 		return fmt.Errorf("conversion failed: %w", err)
 	}
-
-	log.Printf("[CONVERTER] Conversion successful")
 	return nil
 }
 
-// copyFile copies a file from src to dst (for already-SQLite files)
-func copyFile(src, dst string) error {
-	data, err := os.ReadFile(src)
+// convertInPlace is ConvertSource for a source that lives on local disk: a plain SQLite
+// database is served in place through a symlink instead of being copied. With the fts arg
+// it is copied, the search index must not be written into the user's database.
+func convertInPlace(sourcePath, destPath string, opts *ConvertOptions) (*ConvertResult, error) {
+	src, err := openSource(sourcePath, opts.contentType())
 	if err != nil {
+		return nil, err
+	}
+	driverName, err := src.driver(opts)
+	plain := src.file != nil
+	src.Close()
+	if err != nil || driverName != "sqlite" || !plain || opts.searchIndex() {
+		return ConvertSource(sourcePath, destPath, opts)
+	}
+
+	target, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+	err = publishAtomically(destPath, func(tmpPath string) error {
+		return os.Symlink(target, tmpPath)
+	})
+	if err != nil {
+		// e.g. no symlink privilege on Windows
+		log.Printf("[CONVERTER] Warning: failed to link %s, copying instead: %v", sourcePath, err)
+		return ConvertSource(sourcePath, destPath, opts)
+	}
+	log.Printf("[CONVERTER] Source is already SQLite, serving %s in place", sourcePath)
+	return &ConvertResult{Driver: "sqlite"}, nil
+}
+
+// copySQLite publishes a copy of a source that already is a SQLite database, with a search
+// index when the options ask for one
+func copySQLite(src io.Reader, destPath string, opts *ConvertOptions) (*ConvertResult, error) {
+	log.Printf("[CONVERTER] Source is already SQLite, copying")
+	err := publishAtomically(destPath, func(tmpPath string) error {
+		if err := copyFile(src, tmpPath); err != nil {
+			return err
+		}
+		if opts.searchIndex() {
+			return buildSearchIndex(tmpPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ConvertResult{Driver: "sqlite"}, nil
+}
+
+// copyFile writes the content of src to dst (for already-SQLite sources)
+func copyFile(src io.Reader, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
 		return err
 	}
-	return os.WriteFile(dst, data, 0644)
+	return out.Close()
 }
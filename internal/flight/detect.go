@@ -0,0 +1,296 @@
+package flight
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a source is read for content detection
+const sniffLen = 8192
+
+// tarMagicOffset is the position of the magic in the first tar header block
+const tarMagicOffset = 257
+
+// extensionMap maps file extensions to mksqlite drivers ("sqlite" means copy as-is)
+var extensionMap = map[string]string{
+	".csv":      "csv",
+	".tsv":      "csv",
+	".xlsx":     "excel",
+	".xls":      "excel",
+	".tbc":      "excel", // old tbc support? just copy map
+	".zip":      "zip",
+	".tar":      "tar",
+	".html":     "html",
+	".htm":      "html",
+	".json":     "json",
+	".ndjson":   "ndjson",
+	".jsonl":    "ndjson",
+	".txt":      "txt",
+	".md":       "markdown",
+	".markdown": "markdown",
+	".db":       "sqlite",
+	".sqlite":   "sqlite",
+	".sqlite3":  "sqlite",
+	".parquet":  "parquet",
+	".pq":       "parquet",
+	".arrow":    "arrow",
+	".arrows":   "arrow",
+	".feather":  "arrow",
+	".ipc":      "arrow",
+}
+
+// contentTypeMap maps the media types sources report to mksqlite drivers.
+// Generic types (text/plain, application/octet-stream) are deliberately absent.
+var contentTypeMap = map[string]string{
+	"text/csv":                  "csv",
+	"application/csv":           "csv",
+	"text/tab-separated-values": "csv",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "excel",
+	"application/vnd.ms-excel":            "excel",
+	"application/zip":                     "zip",
+	"application/x-zip-compressed":        "zip",
+	"application/x-tar":                   "tar",
+	"text/html":                           "html",
+	"application/xhtml+xml":               "html",
+	"application/json":                    "json",
+	"text/json":                           "json",
+	"application/x-ndjson":                "ndjson",
+	"application/jsonl":                   "ndjson",
+	"application/x-jsonlines":             "ndjson",
+	"text/markdown":                       "markdown",
+	"application/vnd.sqlite3":             "sqlite",
+	"application/x-sqlite3":               "sqlite",
+	"application/vnd.apache.parquet":      "parquet",
+	"application/x-parquet":               "parquet",
+	"application/vnd.apache.arrow.file":   "arrow",
+	"application/vnd.apache.arrow.stream": "arrow",
+}
+
+// Magic numbers of the binary formats recognised by DetectDriver
+var (
+	magicSQLite = []byte("SQLite format 3\x00")
+	magicZip    = []byte("PK\x03\x04")
+	magicZipEnd = []byte("PK\x05\x06") // empty archive
+	magicOLE2   = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	magicTar    = []byte("ustar") // at tarMagicOffset, POSIX and GNU
+	utf8BOM     = []byte{0xEF, 0xBB, 0xBF}
+)
+
+// DetectDriver chooses the mksqlite driver for a source file. Sources are often
+// extensionless (API endpoints, download?id=...) or mislabeled, so the checks are, in order:
+//
+//  1. magic bytes of binary formats (SQLite, ZIP/XLSX, legacy XLS, tar, Parquet, Arrow),
+//     which are conclusive
+//  2. the Content-Type reported by the source (e.g. the HTTP header captured by OpenFile)
+//  3. HTML, JSON and NDJSON structure at the start of the content
+//  4. the file extension (extensionMap), except the generic .txt
+//  5. a delimiter heuristic for CSV-like text, then plain text
+//
+// Compressed sources (gzip, bzip2, zstd, xz) are looked through: the checks run on the
+// decompressed content and the extension inside the compression one (data.csv.gz is csv).
+// The returned driver is "sqlite" for databases that are copied as-is.
+func DetectDriver(sourcePath, contentType string) (string, error) {
+	src, err := openSource(sourcePath, contentType)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	return src.detectDriver()
+}
+
+// detectDriver implements DetectDriver for a content sample. name supplies the extension;
+// zipIsXLSX tells workbooks from plain ZIP archives.
+func detectDriver(name string, sample []byte, contentType string, zipIsXLSX func() bool) (string, error) {
+	if driver := sniffBinary(sample, zipIsXLSX); driver != "" {
+		log.Printf("[CONVERTER] Detected %s from file signature", driver)
+		return driver, nil
+	}
+
+	if driver := driverForContentType(contentType); driver != "" {
+		log.Printf("[CONVERTER] Detected %s from Content-Type %s", driver, contentType)
+		return driver, nil
+	}
+
+	text, isText := sampleText(sample)
+	if isText {
+		if driver := sniffStructuredText(text); driver != "" {
+			if driver == "json" && extensionMap[strings.ToLower(filepath.Ext(name))] == "ndjson" {
+				// A single record looks like a JSON document
+				driver = "ndjson"
+			}
+			log.Printf("[CONVERTER] Detected %s from content", driver)
+			return driver, nil
+		}
+	}
+
+	// .txt says nothing about the layout, exported CSVs are often saved as download.txt
+	ext := strings.ToLower(filepath.Ext(name))
+	if driver, ok := extensionMap[ext]; ok && driver != "txt" {
+		return driver, nil
+	}
+
+	if isText {
+		if delimiter, ok := sniffDelimiter(text); ok {
+			log.Printf("[CONVERTER] Detected csv (delimiter %q) from content", delimiter)
+			return "csv", nil
+		}
+		if strings.TrimSpace(text) != "" {
+			log.Printf("[CONVERTER] Treating unrecognised text as txt")
+			return "txt", nil
+		}
+	}
+	if extensionMap[ext] == "txt" {
+		return "txt", nil
+	}
+
+	if ext == "" {
+		return "", fmt.Errorf("unsupported file type: unrecognised content")
+	}
+	return "", fmt.Errorf("unsupported file type: %s", ext)
+}
+
+// sniffBinary recognises binary formats by their magic numbers
+func sniffBinary(sample []byte, zipIsXLSX func() bool) string {
+	switch {
+	case bytes.HasPrefix(sample, magicSQLite):
+		return "sqlite"
+	case bytes.HasPrefix(sample, magicZip) || bytes.HasPrefix(sample, magicZipEnd):
+		if zipIsXLSX() {
+			return "excel"
+		}
+		return "zip"
+	case bytes.HasPrefix(sample, magicOLE2):
+		return "excel"
+	case bytes.HasPrefix(sample, magicParquet):
+		return "parquet"
+	case bytes.HasPrefix(sample, magicArrowIPC):
+		return "arrow"
+	case len(sample) > tarMagicOffset+len(magicTar) && bytes.Equal(sample[tarMagicOffset:tarMagicOffset+len(magicTar)], magicTar):
+		return "tar"
+	}
+	return ""
+}
+
+// isXLSX reports whether a ZIP archive is an Office Open XML workbook
+func isXLSX(path string) bool {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// driverForContentType maps a Content-Type header value to a driver, "" if generic or unknown
+func driverForContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return contentTypeMap[strings.ToLower(mediaType)]
+}
+
+// sampleText returns the sample as text if it looks like UTF-8 text (BOM stripped)
+func sampleText(sample []byte) (string, bool) {
+	sample = bytes.TrimPrefix(sample, utf8BOM)
+	if bytes.IndexByte(sample, 0) != -1 {
+		return "", false
+	}
+	// The sample may end in the middle of a multi-byte rune
+	for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+	if !utf8.Valid(sample) {
+		return "", false
+	}
+	return string(sample), true
+}
+
+// sniffStructuredText recognises HTML documents and JSON values
+func sniffStructuredText(text string) string {
+	trimmed := strings.TrimSpace(text)
+	lower := strings.ToLower(trimmed)
+
+	if strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html") ||
+		(strings.HasPrefix(lower, "<") && strings.Contains(lower, "<table")) {
+		return "html"
+	}
+
+	if isNDJSON(trimmed) {
+		return "ndjson"
+	}
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		// Two valid tokens rule out markdown links and similar bracketed text
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		if _, err := dec.Token(); err == nil {
+			if _, err := dec.Token(); err == nil {
+				return "json"
+			}
+		}
+	}
+	return ""
+}
+
+// isNDJSON reports whether text starts with a JSON object on a line of its own followed
+// by another line holding an object
+func isNDJSON(text string) bool {
+	first, rest, found := strings.Cut(text, "\n")
+	first = strings.TrimSpace(first)
+	if !found || !strings.HasPrefix(first, "{") || !json.Valid([]byte(first)) {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(rest), "{")
+}
+
+// sniffDelimiter looks for a delimiter that splits every sampled line into the same
+// number (at least two) of fields. The last line is ignored as it may be truncated.
+func sniffDelimiter(text string) (rune, bool) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) > 1 && len(text) >= sniffLen {
+		lines = lines[:len(lines)-1]
+	}
+	var nonEmpty []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			nonEmpty = append(nonEmpty, line)
+		}
+	}
+	if len(nonEmpty) < 2 {
+		return 0, false
+	}
+	sample := strings.Join(nonEmpty, "\n")
+
+	best, bestFields := rune(0), 1
+	for _, delimiter := range []rune{',', '\t', ';', '|'} {
+		reader := csv.NewReader(strings.NewReader(sample))
+		reader.Comma = delimiter
+		reader.LazyQuotes = true
+		reader.FieldsPerRecord = 0 // all records must match the first
+
+		records, err := reader.ReadAll()
+		if err != nil || len(records) < 2 {
+			continue
+		}
+		if fields := len(records[0]); fields > bestFields {
+			best, bestFields = delimiter, fields
+		}
+	}
+	return best, best != 0
+}
@@ -0,0 +1,223 @@
+package flight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/vfs"
+)
+
+// SourceFingerprint identifies one version of a remote source file.
+// It is recorded next to a cache file when the cache is built and compared
+// against a fresh Stat of the source once the cache TTL expires.
+type SourceFingerprint struct {
+	ModTime  time.Time `json:"mod_time"`
+	Size     int64     `json:"size"`
+	HashType string    `json:"hash_type,omitempty"` // e.g. "md5" (the ETag on S3 compatible backends)
+	Hash     string    `json:"hash,omitempty"`
+	Convert  string    `json:"convert,omitempty"` // ConvertOptions.Hash of the mksqlite_config used
+}
+
+// NodeFingerprint builds a fingerprint from VFS metadata.
+// The backend hash is only requested when it is cheap (not computed by reading the file),
+// so local remotes fall back to ModTime and Size like HandleLocalDataset does.
+func NodeFingerprint(node vfs.Node) SourceFingerprint {
+	fp := SourceFingerprint{
+		ModTime: node.ModTime().UTC(),
+		Size:    node.Size(),
+	}
+
+	obj, ok := node.DirEntry().(fs.Object)
+	if !ok || obj == nil {
+		return fp
+	}
+	if obj.Fs().Features().SlowHash {
+		return fp
+	}
+	hashType := obj.Fs().Hashes().GetOne()
+	if hashType == hash.None {
+		return fp
+	}
+	if sum, err := obj.Hash(context.Background(), hashType); err == nil && sum != "" {
+		fp.HashType = hashType.String()
+		fp.Hash = sum
+	}
+	return fp
+}
+
+// Equal reports whether two fingerprints describe the same source content.
+// Hashes are authoritative when both sides have one of the same type, otherwise
+// size and modification time (to the second, as precision differs between backends) must match.
+// A cache built with different conversion options never matches.
+func (f SourceFingerprint) Equal(other SourceFingerprint) bool {
+	if f.Size != other.Size || f.Convert != other.Convert {
+		return false
+	}
+	if f.Hash != "" && f.HashType == other.HashType && other.Hash != "" {
+		return f.Hash == other.Hash
+	}
+	if f.ModTime.IsZero() || other.ModTime.IsZero() {
+		// Nothing reliable left to compare
+		return false
+	}
+	return f.ModTime.Truncate(time.Second).Equal(other.ModTime.Truncate(time.Second))
+}
+
+// String returns a compact human readable form, e.g. "md5:abc123/1024" or "2026-01-02T15:04:05Z/1024"
+func (f SourceFingerprint) String() string {
+	if f.Hash != "" {
+		return fmt.Sprintf("%s:%s/%d", f.HashType, f.Hash, f.Size)
+	}
+	return fmt.Sprintf("%s/%d", f.ModTime.Format(time.RFC3339), f.Size)
+}
+
+// fingerprintPath returns the sidecar file holding the source fingerprint of a cache file
+func fingerprintPath(cachePath string) string {
+	return cachePath + ".source.json"
+}
+
+// ReadFingerprint loads the fingerprint recorded for a cache file.
+// Returns nil without error if none was recorded (e.g. caches built by older versions).
+func ReadFingerprint(cachePath string) (*SourceFingerprint, error) {
+	data, err := os.ReadFile(fingerprintPath(cachePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var fp SourceFingerprint
+	if err := json.Unmarshal(data, &fp); err != nil {
+		return nil, fmt.Errorf("failed to parse fingerprint: %w", err)
+	}
+	return &fp, nil
+}
+
+// WriteFingerprint records the fingerprint of the source a cache file was built from
+func WriteFingerprint(cachePath string, fp SourceFingerprint) error {
+	data, err := json.Marshal(fp)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fingerprintPath(cachePath), data, 0644)
+}
+
+// RemoveFingerprint deletes the fingerprint sidecar of a cache file, if any, and forgets
+// when its source was last checked
+func RemoveFingerprint(cachePath string) {
+	os.Remove(fingerprintPath(cachePath))
+	sourceChecks.Lock()
+	delete(sourceChecks.last, cachePath)
+	sourceChecks.Unlock()
+}
+
+// SourceUnchanged reports whether an existing cache file was built from a source
+// matching the current fingerprint. Caches without a recorded fingerprint never match.
+func SourceUnchanged(cachePath string, current SourceFingerprint) bool {
+	info, err := os.Stat(cachePath)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+
+	recorded, err := ReadFingerprint(cachePath)
+	if err != nil || recorded == nil {
+		return false
+	}
+	return recorded.Equal(current)
+}
+
+// SourceChanged reports whether a cache file has a recorded fingerprint that no longer
+// matches the source. Unlike SourceUnchanged, caches without a fingerprint (directory
+// indexes, older builds) are not reported: there is nothing to compare them with.
+func SourceChanged(cachePath string, current SourceFingerprint) bool {
+	recorded, err := ReadFingerprint(cachePath)
+	if err != nil || recorded == nil {
+		return false
+	}
+	return !recorded.Equal(current)
+}
+
+// defaultSourceCheckInterval is how often a cache hit re-checks its source by default
+const defaultSourceCheckInterval = time.Minute
+
+// sourceChecks remembers when the source of each cache file was last checked on a hit
+var sourceChecks = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// GetSourceCheckInterval returns the "source_check_interval" app setting in rclone duration
+// syntax ("30s", "5m"); 0 checks on every hit. Defaults to one minute.
+func GetSourceCheckInterval(app core.App) time.Duration {
+	val := strings.TrimSpace(GetAppSetting(app, "source_check_interval"))
+	if val == "" {
+		return defaultSourceCheckInterval
+	}
+
+	interval, err := fs.ParseDuration(val)
+	if err != nil || interval < 0 {
+		log.Printf("[CACHE] Ignoring invalid app_settings source_check_interval %q: %v", val, err)
+		return defaultSourceCheckInterval
+	}
+	return interval
+}
+
+// sourceCheckDue reports whether the source of a valid cache should be checked for changes,
+// at most once per interval for each cache file, and records the check. Checks older than
+// the interval are dropped, so cache files that are gone don't stay remembered.
+func sourceCheckDue(cachePath string, interval time.Duration) bool {
+	sourceChecks.Lock()
+	defer sourceChecks.Unlock()
+
+	now := time.Now()
+	if last, ok := sourceChecks.last[cachePath]; ok && now.Sub(last) < interval {
+		return false
+	}
+	for path, last := range sourceChecks.last {
+		if now.Sub(last) >= interval {
+			delete(sourceChecks.last, path)
+		}
+	}
+	sourceChecks.last[cachePath] = now
+	return true
+}
+
+// RenewCache resets the age of a cache file so ValidateCache treats it as fresh for another TTL.
+// A link to a SQLite source served in place is re-created: Chtimes would follow it and
+// change the modification time of the user's database.
+func RenewCache(cachePath string) error {
+	info, err := os.Lstat(cachePath)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		now := time.Now()
+		return os.Chtimes(cachePath, now, now)
+	}
+
+	target, err := os.Readlink(cachePath)
+	if err != nil {
+		return fmt.Errorf("failed to read cache link: %w", err)
+	}
+	tmpPath := filepath.Join(filepath.Dir(cachePath),
+		fmt.Sprintf(".%s.%d%s", filepath.Base(cachePath), time.Now().UnixNano(), buildingSuffix))
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return fmt.Errorf("failed to renew cache link: %w", err)
+	}
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to renew cache link: %w", err)
+	}
+	return nil
+}
@@ -55,6 +55,12 @@ func GetSQLiterServer() *sqliter.Server {
 	return globalSQLiterServer
 }
 
+// flightCommands are the subcommands Flight adds to the PocketBase root command
+var flightCommands = map[string]bool{
+	"cache":   true,
+	"remotes": true,
+}
+
 func Flight() {
 
 	// Default to "serve" command if no arguments are provided
@@ -91,7 +97,8 @@ func Flight() {
 		}
 
 		// Check if it's a URL (contains scheme) or path, and not a flag or known command
-		if !strings.HasPrefix(arg, "-") && (strings.Contains(arg, "://") || strings.HasPrefix(arg, "/")) {
+		// (arguments of Flight's own subcommands, e.g. `cache purge /s3:/...`, are passed through)
+		if !flightCommands[os.Args[1]] && !strings.HasPrefix(arg, "-") && (strings.Contains(arg, "://") || strings.HasPrefix(arg, "/")) {
 			startRequestURL = arg
 			// If we found a URL, we implicitly mean "serve" mode if not specified?
 			if !isServe {
@@ -145,6 +152,9 @@ func Flight() {
 
 	log.Printf("Using data directory: %s", app.DataDir())
 
+	app.RootCmd.AddCommand(NewCacheCommand(app))
+	app.RootCmd.AddCommand(NewRemotesCommand(app))
+
 	// Initialize SQLiter server
 	// SQLiter handles everything from ColumnSetPath → Query
 	sqliterConfig := sqliter.DefaultConfig()
@@ -163,6 +173,19 @@ func Flight() {
 	}
 	log.Printf("Rclone manager initialized with cache dir: %s", cacheDir)
 
+	// Stop VFS background work and remove VFS cache files with the app (serve and commands),
+	// and keep the cache hits counted since the last janitor run
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		GetRcloneManager().Shutdown()
+		if err := FlushCacheHits(e.App); err != nil {
+			log.Printf("[CACHE] Warning: failed to flush cache hits: %v", err)
+		}
+		return e.Next()
+	})
+
+	// Drop databases left half-built by a previous run that crashed or was killed
+	CleanupStaleBuilds(cacheDir)
+
 	// OnServe: Setup collections when server starts (database is ready by then)
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		// Ensure collections exist (database is ready now)
@@ -172,6 +195,21 @@ func Flight() {
 		}
 		log.Printf("PocketBase collections ensured")
 
+		// Drop caches named by an older cache key scheme
+		MigrateCacheKeys(se.App)
+
+		// Enforce the cache_max_size quota in the background
+		StartCacheJanitor(se.App)
+
+		// Shut down VFS instances of remotes nobody used for a while
+		StartVFSJanitor(se.App)
+
+		// Drop VFS instances and caches of remotes that are edited or deleted
+		WatchRemotes(se.App)
+
+		// Warm caches of data_pipelines that have a schedule
+		StartPipelineScheduler(se.App)
+
 		// Ensure superuser exists
 		if err := EnsureSuperUser(se.App, "admin@example.com", "password123"); err != nil {
 			log.Printf("Error ensuring superuser: %v", err)
@@ -180,6 +218,8 @@ func Flight() {
 		// Configure centralized routing
 		// Configure centralized routing
 		ConfigureRouting(se.App, sqliterServer)
+		RegisterCacheRoutes(se)
+		RegisterRemoteRoutes(se)
 
 		// Launch Chrome on macOS if we are serving
 		if isServe && httpAddr != "" && runtime.GOOS == "darwin" {
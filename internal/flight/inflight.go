@@ -0,0 +1,84 @@
+package flight
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// cacheBuildWait bounds how long a request waits for a build started by another request
+const cacheBuildWait = 5 * time.Minute
+
+// ErrBuildWaitTimeout is returned to requests that gave up waiting for another request's build
+var ErrBuildWaitTimeout = errors.New("timed out waiting for cache build in progress")
+
+// buildCall is one in-flight build; done is closed once err is set
+type buildCall struct {
+	done chan struct{}
+	err  error
+}
+
+// buildGroup deduplicates concurrent builds of the same cache key, similar to singleflight
+// but with a bounded wait for callers that join an existing build.
+type buildGroup struct {
+	mu    sync.Mutex
+	calls map[string]*buildCall
+}
+
+// cacheBuilds coordinates every fetch+convert that writes into pb_data/cache
+var cacheBuilds = &buildGroup{calls: make(map[string]*buildCall)}
+
+// Do runs build for key unless a build for the same key is already running, in which case
+// it waits up to wait for that build and returns its error. Every waiter sees the outcome
+// of the build it joined. shared reports whether the result came from another caller's build.
+func (g *buildGroup) Do(key string, wait time.Duration, build func() error) (shared bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		log.Printf("[CACHE] Build for %s already in progress, waiting", key)
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-call.done:
+			return true, call.err
+		case <-timer.C:
+			return true, fmt.Errorf("%w: %s", ErrBuildWaitTimeout, key)
+		}
+	}
+
+	call := &buildCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("cache build panicked: %v", r)
+			err = call.err
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.err = build()
+	return false, call.err
+}
+
+// InFlight reports whether a build for key is currently running
+func (g *buildGroup) InFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.calls[key]
+	return ok
+}
+
+// DedupBuild runs build through the shared cache build coordinator; see buildGroup.Do.
+// Callers that write into pb_data/cache outside HandleBanquet (warming, refresh) use it
+// so they never race a request building the same key.
+func DedupBuild(key string, wait time.Duration, build func() error) (shared bool, err error) {
+	return cacheBuilds.Do(key, wait, build)
+}
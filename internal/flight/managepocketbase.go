@@ -23,6 +23,9 @@ func EnsureCollections(app core.App) error {
 	if err := EnsureAppSettings(app); err != nil {
 		return err
 	}
+	if err := EnsureCacheEntries(app); err != nil {
+		return err
+	}
 	return EnsureBanquetLinks(app)
 }
 
@@ -69,26 +72,31 @@ func EnsureBanquetLinks(app core.App) error {
 func EnsureRcloneRemotes(app core.App) error {
 	name := "rclone_remotes"
 	existing, err := app.FindCollectionByNameOrId(name)
-	if err == nil && existing != nil {
-		return nil
-	}
+	if err != nil || existing == nil {
+		collection := core.NewBaseCollection(name)
+		collection.Fields.Add(&core.TextField{Name: "name", Required: true})
+		collection.Fields.Add(&core.TextField{Name: "type", Required: true})    // e.g. s3, drive
+		collection.Fields.Add(&core.JSONField{Name: "config"})                  // e.g. {"access_key_id": "...", ...}
+		collection.Fields.Add(&core.JSONField{Name: "vfs_settings"})            // Optional VFS tuning per remote
+		collection.Fields.Add(&core.BoolField{Name: "enabled", Required: true}) // Enable/disable remote
+		collection.Fields.Add(&core.TextField{Name: "description"})             // Documentation
 
-	collection := core.NewBaseCollection(name)
-	collection.Fields.Add(&core.TextField{Name: "name", Required: true})
-	collection.Fields.Add(&core.TextField{Name: "type", Required: true})    // e.g. s3, drive
-	collection.Fields.Add(&core.JSONField{Name: "config"})                  // e.g. {"access_key_id": "...", ...}
-	collection.Fields.Add(&core.JSONField{Name: "vfs_settings"})            // Optional VFS tuning per remote
-	collection.Fields.Add(&core.BoolField{Name: "enabled", Required: true}) // Enable/disable remote
-	collection.Fields.Add(&core.TextField{Name: "description"})             // Documentation
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+	}
 
-	return app.Save(collection)
+	return ensureFields(app, name,
+		&core.NumberField{Name: "cache_ttl"}, // default cache TTL in minutes for this remote
+		&core.TextField{Name: "root"},        // path or connection string the remote is scoped to
+	)
 }
 
 func EnsureMksqliteConfigs(app core.App) error {
 	name := "mksqlite_configs"
 	existing, err := app.FindCollectionByNameOrId(name)
 	if err == nil && existing != nil {
-		return nil
+		return ensureMksqliteConfigFields(app)
 	}
 
 	collection := core.NewBaseCollection(name)
@@ -96,14 +104,24 @@ func EnsureMksqliteConfigs(app core.App) error {
 	collection.Fields.Add(&core.TextField{Name: "driver"}) // e.g. csv, json
 	collection.Fields.Add(&core.JSONField{Name: "args"})   // e.g. {"delimiter": ","}
 
-	return app.Save(collection)
+	if err := app.Save(collection); err != nil {
+		return err
+	}
+	return ensureMksqliteConfigFields(app)
+}
+
+// ensureMksqliteConfigFields adds the mksqlite_configs fields introduced after the initial schema
+func ensureMksqliteConfigFields(app core.App) error {
+	return ensureFields(app, "mksqlite_configs",
+		&core.TextField{Name: "extensions"}, // default config for these file extensions, e.g. "csv,tsv"
+	)
 }
 
 func EnsureDataPipelines(app core.App) error {
 	name := "data_pipelines"
 	existing, err := app.FindCollectionByNameOrId(name)
 	if err == nil && existing != nil {
-		return nil
+		return ensurePipelineFields(app)
 	}
 
 	rcloneRemotes, err := app.FindCollectionByNameOrId("rclone_remotes")
@@ -139,6 +157,96 @@ func EnsureDataPipelines(app core.App) error {
 
 	collection.Fields.Add(&core.NumberField{Name: "cache_ttl"}) // in minutes
 
+	if err := app.Save(collection); err != nil {
+		return err
+	}
+	return ensurePipelineFields(app)
+}
+
+// ensurePipelineFields adds the data_pipelines fields introduced after the initial schema
+func ensurePipelineFields(app core.App) error {
+	return ensureFields(app, "data_pipelines",
+		&core.BoolField{Name: "stale_while_revalidate"}, // serve expired caches while refreshing in the background
+		&core.TextField{Name: "schedule"},               // cron expression for cache warming, see StartPipelineScheduler
+		&core.DateField{Name: "last_run"},
+		&core.SelectField{
+			Name:      "last_status",
+			Values:    []string{PipelineStatusRunning, PipelineStatusSuccess, PipelineStatusFailed},
+			MaxSelect: 1,
+		},
+		&core.TextField{Name: "last_error"},
+		&core.NumberField{Name: "last_duration_ms", OnlyInt: true},
+	)
+}
+
+// EnsureCacheEntries creates the cache manifest: one record per cache file built by Flight.
+// See RecordCacheBuild and RecordCacheHit.
+func EnsureCacheEntries(app core.App) error {
+	name := "cache_entries"
+	existing, err := app.FindCollectionByNameOrId(name)
+	if err == nil && existing != nil {
+		return ensureCacheEntryFields(app)
+	}
+
+	rcloneRemotes, err := app.FindCollectionByNameOrId("rclone_remotes")
+	if err != nil {
+		return fmt.Errorf("failed to find rclone_remotes: %w", err)
+	}
+
+	collection := core.NewBaseCollection(name)
+	collection.Fields.Add(&core.TextField{Name: "cache_key", Required: true})
+	collection.Fields.Add(&core.TextField{Name: "cache_path"})
+	collection.Fields.Add(&core.TextField{Name: "source_url"})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "rclone_remote",
+		CollectionId:  rcloneRemotes.Id,
+		CascadeDelete: false,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.TextField{Name: "source_path"})
+	collection.Fields.Add(&core.TextField{Name: "source_fingerprint"})
+	collection.Fields.Add(&core.TextField{Name: "converter"})                   // mksqlite driver, e.g. csv, excel
+	collection.Fields.Add(&core.NumberField{Name: "size_bytes", OnlyInt: true}) // size of the .db file
+	collection.Fields.Add(&core.NumberField{Name: "build_ms", OnlyInt: true})   // fetch + convert duration
+	collection.Fields.Add(&core.DateField{Name: "built_at"})
+	collection.Fields.Add(&core.DateField{Name: "last_access"})
+	collection.Fields.Add(&core.NumberField{Name: "hit_count", OnlyInt: true})
+	collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+	collection.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+	collection.AddIndex("idx_cache_entries_cache_key", true, "cache_key", "")
+
+	if err := app.Save(collection); err != nil {
+		return err
+	}
+	return ensureCacheEntryFields(app)
+}
+
+// ensureCacheEntryFields adds the cache_entries fields introduced after the initial schema
+func ensureCacheEntryFields(app core.App) error {
+	return ensureFields(app, "cache_entries",
+		&core.TextField{Name: "archive_key"}, // downloaded archive the entry was extracted from, see fetchArchive
+	)
+}
+
+// ensureFields adds any of the given fields that are missing from an existing collection.
+// Collections are only created once, so fields introduced later are added here to upgrade older databases.
+func ensureFields(app core.App, name string, fields ...core.Field) error {
+	collection, err := app.FindCollectionByNameOrId(name)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", name, err)
+	}
+
+	changed := false
+	for _, field := range fields {
+		if collection.Fields.GetByName(field.GetName()) == nil {
+			collection.Fields.Add(field)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
 	return app.Save(collection)
 }
 
@@ -0,0 +1,145 @@
+package flight
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// CacheEntry describes a cache file built by Flight, as recorded in the cache_entries collection
+type CacheEntry struct {
+	CacheKey    string
+	CachePath   string
+	SourceURL   string        // dataset URL the cache was built for (credentials redacted)
+	RemoteID    string        // rclone_remotes record id, empty for local and ad-hoc remotes
+	SourcePath  string        // DataSetPath on the remote, or the resolved local path
+	Fingerprint string        // SourceFingerprint.String() of the source at build time
+	Driver      string        // converter that produced the database
+	ArchiveKey  string        // key of the archive in cache/archives an entry was extracted from
+	BuildTime   time.Duration // fetch + convert duration
+}
+
+// RecordCacheBuild creates or updates the cache_entries record for a freshly built cache file.
+// Hit counts are kept across rebuilds so the manifest shows how popular a dataset is overall.
+func RecordCacheBuild(app core.App, entry CacheEntry) error {
+	record, err := app.FindFirstRecordByData("cache_entries", "cache_key", entry.CacheKey)
+	if err != nil || record == nil {
+		collection, err := app.FindCollectionByNameOrId("cache_entries")
+		if err != nil {
+			return fmt.Errorf("failed to find cache_entries collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("cache_key", entry.CacheKey)
+	}
+
+	var size int64
+	if info, err := os.Stat(entry.CachePath); err == nil {
+		size = info.Size()
+	}
+
+	now := types.NowDateTime()
+	record.Set("cache_path", entry.CachePath)
+	record.Set("source_url", entry.SourceURL)
+	record.Set("rclone_remote", entry.RemoteID)
+	record.Set("source_path", entry.SourcePath)
+	record.Set("source_fingerprint", entry.Fingerprint)
+	record.Set("converter", entry.Driver)
+	record.Set("archive_key", entry.ArchiveKey)
+	record.Set("size_bytes", size)
+	record.Set("build_ms", entry.BuildTime.Milliseconds())
+	record.Set("built_at", now)
+	record.Set("last_access", now)
+
+	return app.Save(record)
+}
+
+// pendingHits buffers cache hits so serving a request never writes to the database;
+// FlushCacheHits moves them into cache_entries
+var pendingHits = struct {
+	sync.Mutex
+	hits map[string]cacheHit
+}{hits: make(map[string]cacheHit)}
+
+// cacheHit is the buffered usage of one cache key since the last flush
+type cacheHit struct {
+	count      int
+	lastAccess time.Time
+}
+
+// RecordCacheHit counts a hit on a cache entry in memory. The hit count and last access
+// time reach cache_entries with the next FlushCacheHits.
+func RecordCacheHit(app core.App, cacheKey string) {
+	pendingHits.Lock()
+	defer pendingHits.Unlock()
+
+	hit := pendingHits.hits[cacheKey]
+	hit.count++
+	hit.lastAccess = time.Now()
+	pendingHits.hits[cacheKey] = hit
+}
+
+// FlushCacheHits adds the buffered hits to their cache_entries records in one transaction.
+// Cache files built before the manifest existed have no record and are ignored.
+// The cache janitor flushes on every run; readers of hit_count and last_access flush first.
+func FlushCacheHits(app core.App) error {
+	pendingHits.Lock()
+	hits := pendingHits.hits
+	pendingHits.hits = make(map[string]cacheHit)
+	pendingHits.Unlock()
+
+	if len(hits) == 0 {
+		return nil
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		for cacheKey, hit := range hits {
+			record, err := txApp.FindFirstRecordByData("cache_entries", "cache_key", cacheKey)
+			if err != nil || record == nil {
+				continue
+			}
+
+			record.Set("hit_count", record.GetInt("hit_count")+hit.count)
+			if lastAccess, err := types.ParseDateTime(hit.lastAccess); err == nil && lastAccess.After(record.GetDateTime("last_access")) {
+				record.Set("last_access", lastAccess)
+			}
+			if err := txApp.Save(record); err != nil {
+				return fmt.Errorf("failed to record cache hits for %s: %w", cacheKey, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveCacheEntry deletes the cache_entries record for a cache key, if any
+func RemoveCacheEntry(app core.App, cacheKey string) error {
+	record, err := app.FindFirstRecordByData("cache_entries", "cache_key", cacheKey)
+	if err != nil || record == nil {
+		return nil
+	}
+	return app.Delete(record)
+}
+
+// datasetURL returns the URL identifying a banquet dataset (without table, columns or query)
+func datasetURL(b *banquet.Banquet) string {
+	u := url.URL{
+		Scheme: b.Scheme,
+		User:   b.User,
+		Host:   b.Host,
+		Path:   b.DataSetPath,
+	}
+	return u.Redacted()
+}
+
+// remoteRecordID returns the id of a saved remote record, or "" for local datasets and ad-hoc remotes
+func remoteRecordID(remoteRecord *core.Record) string {
+	if remoteRecord == nil || remoteRecord.IsNew() {
+		return ""
+	}
+	return remoteRecord.Id
+}
@@ -0,0 +1,513 @@
+package flight
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/darianmavgo/mksqlite/converters"
+	"github.com/darianmavgo/mksqlite/converters/common"
+)
+
+// Columns linking child tables to their parent rows when arrays are spilled into tables
+// (array_tables): every table gets an _id, child rows the parent's _id and their position
+const (
+	ndjsonIDColumn     = "_id"
+	ndjsonParentColumn = "_parent_id"
+	ndjsonIndexColumn  = "_index"
+)
+
+func init() {
+	converters.Register("ndjson", &ndjsonDriver{})
+}
+
+// ndjsonDriver converts newline-delimited JSON (JSON Lines): one record per line, read one
+// at a time. The table has the union of the fields of all records; nested objects are
+// flattened into dotted columns ("user.address.city").
+type ndjsonDriver struct{}
+
+// Open implements common.Driver
+func (d *ndjsonDriver) Open(source io.Reader, config *common.ConversionConfig) (common.RowProvider, error) {
+	table := "tb0"
+	if config != nil && config.TableName != "" {
+		table = config.TableName
+	}
+	return &ndjsonProvider{source: source, table: table, depth: -1}, nil
+}
+
+// ndjsonProvider streams records into the database through ImportTo. The RowProvider
+// methods serve callers other than ConvertSource and hold the converted rows in memory.
+type ndjsonProvider struct {
+	source      io.Reader
+	table       string
+	depth       int  // levels of nested objects flattened into columns, -1 for all
+	arrayTables bool // spill arrays into child tables instead of JSON text
+
+	loaded *ndjsonMemory
+}
+
+// applyArgs implements argsApplier: flatten_depth and array_tables
+func (p *ndjsonProvider) applyArgs(opts *ConvertOptions) {
+	if opts == nil {
+		return
+	}
+	if depth, ok := opts.intArg("flatten_depth"); ok {
+		p.depth = depth
+	}
+	p.arrayTables = opts.boolArg("array_tables", false)
+}
+
+// ImportTo implements streamImporter. Tables and columns are created as the records that
+// need them are read.
+func (p *ndjsonProvider) ImportTo(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	sink := &ndjsonSQLSink{tx: tx, tables: map[string]*ndjsonSQLTable{}, arrayTables: p.arrayTables}
+	defer sink.close()
+
+	records, err := p.scan(sink.write)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[CONVERTER] Imported %d ndjson records into %d table(s)", records, len(sink.tables))
+	return nil
+}
+
+func (p *ndjsonProvider) GetTableNames() []string {
+	if err := p.load(); err != nil {
+		return nil
+	}
+	return p.loaded.tables
+}
+
+func (p *ndjsonProvider) GetHeaders(tableName string) []string {
+	if err := p.load(); err != nil {
+		return nil
+	}
+	return p.loaded.columns[tableName]
+}
+
+func (p *ndjsonProvider) ScanRows(tableName string, yield func([]interface{}, error) error) error {
+	if err := p.load(); err != nil {
+		return err
+	}
+	columns := p.loaded.columns[tableName]
+	for _, record := range p.loaded.rows[tableName] {
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			row[i] = record[column]
+		}
+		if err := yield(row, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the whole source into memory for the RowProvider methods
+func (p *ndjsonProvider) load() error {
+	if p.loaded != nil {
+		return nil
+	}
+	mem := &ndjsonMemory{columns: map[string][]string{}, rows: map[string][]map[string]any{}}
+	if _, err := p.scan(mem.write); err != nil {
+		return err
+	}
+	p.loaded = mem
+	return nil
+}
+
+// ndjsonRow is one flattened row, columns in the order they appear in the record
+type ndjsonRow struct {
+	table   string
+	columns []string
+	values  []any
+}
+
+func (r *ndjsonRow) set(column string, value any) {
+	r.columns = append(r.columns, column)
+	r.values = append(r.values, value)
+}
+
+// scan decodes the records of the source and passes their rows to write: the record itself,
+// then the rows of its arrays when they are spilled into tables. Returns the record count.
+func (p *ndjsonProvider) scan(write func(row *ndjsonRow) error) (int, error) {
+	dec := json.NewDecoder(p.source)
+	dec.UseNumber()
+
+	st := &ndjsonScan{ids: map[string]int64{}, columns: map[string]*ndjsonNames{}, tables: newNDJSONNames()}
+	st.tables.name(p.table, p.table)
+	records := 0
+	for {
+		value, err := decodeOrdered(dec)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("invalid JSON in record %d: %w", records+1, err)
+		}
+		records++
+
+		if err := p.emit(p.table, value, nil, st, write); err != nil {
+			return records, err
+		}
+	}
+}
+
+// ndjsonScan is what scan keeps track of across records
+type ndjsonScan struct {
+	ids     map[string]int64        // last _id of each table
+	columns map[string]*ndjsonNames // columns of each table
+	tables  *ndjsonNames            // tables, child tables by parent table and field
+}
+
+// ndjsonLink places a row of a child table: the _id of the parent row and the position of
+// the element in its array
+type ndjsonLink struct {
+	parentID int64
+	index    int
+}
+
+// emit flattens value into a row of table and writes it, followed by the rows of the arrays
+// it spills. link is set for the rows of child tables.
+func (p *ndjsonProvider) emit(table string, value any, link *ndjsonLink, st *ndjsonScan, write func(*ndjsonRow) error) error {
+	row := &ndjsonRow{table: table}
+	st.ids[table]++
+	id := st.ids[table]
+	columns, ok := st.columns[table]
+	if !ok {
+		columns = newNDJSONNames()
+		st.columns[table] = columns
+	}
+	// Set before any field, so a field called _id is the one renamed
+	if p.arrayTables {
+		row.set(columns.name(ndjsonIDColumn, ndjsonIDColumn), id)
+	}
+	if link != nil {
+		row.set(columns.name(ndjsonParentColumn, ndjsonParentColumn), link.parentID)
+		row.set(columns.name(ndjsonIndexColumn, ndjsonIndexColumn), int64(link.index))
+	}
+
+	type spill struct {
+		column string
+		field  string
+		items  []any
+	}
+	var spills []spill
+
+	// field is the path of keys leading to a value, which tells {"a.b": 1} from {"a": {"b": 1}}
+	var flatten func(prefix, field string, obj *orderedObject, depth int)
+	flatten = func(prefix, field string, obj *orderedObject, depth int) {
+		for _, key := range obj.keys {
+			name, path := prefix+key, field+"\x00"+key
+			switch v := obj.values[key].(type) {
+			case *orderedObject:
+				if p.depth < 0 || depth < p.depth {
+					flatten(name+".", path, v, depth+1)
+				} else {
+					row.set(columns.name(path, name), jsonText(v))
+				}
+			case []any:
+				if p.arrayTables {
+					spills = append(spills, spill{name, path, v})
+				} else {
+					row.set(columns.name(path, name), jsonText(v))
+				}
+			default:
+				row.set(columns.name(path, name), jsonValue(v))
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case *orderedObject:
+		flatten("", "", v, 0)
+	case []any:
+		if p.arrayTables {
+			spills = append(spills, spill{"value", "value", v})
+		} else {
+			row.set(columns.name("value", "value"), jsonText(v))
+		}
+	default:
+		row.set(columns.name("value", "value"), jsonValue(v))
+	}
+
+	if err := write(row); err != nil {
+		return err
+	}
+	for _, s := range spills {
+		// Names like tb0_a_b come from a.b, a literal a_b or b of the child table tb0_a
+		childTable := st.tables.name(table+"\x00"+s.field, table+"_"+strings.ReplaceAll(s.column, ".", "_"))
+		for i, item := range s.items {
+			if err := p.emit(childTable, item, &ndjsonLink{parentID: id, index: i}, st, write); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ndjsonNames names the columns of one table, or the tables of a source. SQLite compares
+// names without regard to case, and a literal "a.b" key flattens to the same name as b
+// nested in a, so a field whose name is taken by another field gets a suffix: "ID_2",
+// "a.b_2", "tb0_a_b_2".
+type ndjsonNames struct {
+	byField map[string]string // field (path of keys, or a link column) -> name
+	taken   map[string]bool   // lower-cased names
+}
+
+func newNDJSONNames() *ndjsonNames {
+	return &ndjsonNames{byField: map[string]string{}, taken: map[string]bool{}}
+}
+
+// name returns the name of a field, naming it on first use
+func (n *ndjsonNames) name(field, name string) string {
+	if named, ok := n.byField[field]; ok {
+		return named
+	}
+	named := name
+	for i := 2; n.taken[strings.ToLower(named)]; i++ {
+		named = fmt.Sprintf("%s_%d", name, i)
+	}
+	n.byField[field] = named
+	n.taken[strings.ToLower(named)] = true
+	return named
+}
+
+// orderedObject is a JSON object that keeps its keys in document order, so columns come
+// out in the order the producer wrote them
+type orderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// decodeOrdered reads the next JSON value from dec, objects as *orderedObject
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return decodeOrderedToken(dec, tok)
+}
+
+func decodeOrderedToken(dec *json.Decoder, tok json.Token) (any, error) {
+	switch tok {
+	case json.Delim('{'):
+		obj := &orderedObject{values: map[string]any{}}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := keyTok.(string)
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, seen := obj.values[key]; !seen {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = value
+		}
+		_, err := dec.Token() // '}'
+		return obj, err
+	case json.Delim('['):
+		items := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err := dec.Token() // ']'
+		return items, err
+	}
+	return tok, nil
+}
+
+// jsonValue converts a decoded JSON scalar to the value stored in SQLite
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return v // string or nil
+}
+
+// jsonText encodes a nested object or array kept as a single column
+func jsonText(v any) string {
+	data, _ := json.Marshal(plainJSON(v))
+	return string(data)
+}
+
+// plainJSON turns ordered objects back into values encoding/json can marshal
+func plainJSON(v any) any {
+	switch v := v.(type) {
+	case *orderedObject:
+		m := make(map[string]any, len(v.keys))
+		for _, key := range v.keys {
+			m[key] = plainJSON(v.values[key])
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = plainJSON(item)
+		}
+		return items
+	}
+	return v
+}
+
+// ndjsonSQLTable is a table created by ndjsonSQLSink with the columns it has so far
+type ndjsonSQLTable struct {
+	columns map[string]bool      // lower-cased, as SQLite compares them
+	inserts map[string]*sql.Stmt // by column list
+}
+
+// ndjsonSQLSink writes rows into the database, creating tables on their first row and
+// adding columns when a record brings a new field (the union schema)
+type ndjsonSQLSink struct {
+	tx          *sql.Tx
+	tables      map[string]*ndjsonSQLTable
+	arrayTables bool
+}
+
+func (s *ndjsonSQLSink) write(row *ndjsonRow) error {
+	// Null fields need no column; one appears once a record has a value for it
+	var columns []string
+	var values []any
+	for i, column := range row.columns {
+		if row.values[i] != nil {
+			columns = append(columns, column)
+			values = append(values, row.values[i])
+		}
+	}
+
+	table, ok := s.tables[row.table]
+	if !ok {
+		table = &ndjsonSQLTable{columns: map[string]bool{}, inserts: map[string]*sql.Stmt{}}
+		definition := []string{}
+		if s.arrayTables {
+			definition = append(definition, quoteIdent(ndjsonIDColumn)+" INTEGER PRIMARY KEY")
+			table.columns[ndjsonIDColumn] = true
+		}
+		for i, column := range columns {
+			if !table.columns[strings.ToLower(column)] {
+				definition = append(definition, quoteIdent(column)+" "+sqliteTypeOf(values[i]))
+				table.columns[strings.ToLower(column)] = true
+			}
+		}
+		if len(definition) == 0 {
+			definition = append(definition, quoteIdent("value")+" TEXT")
+			table.columns["value"] = true
+		}
+		if _, err := s.tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(row.table), strings.Join(definition, ", "))); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", row.table, err)
+		}
+		s.tables[row.table] = table
+	}
+
+	for i, column := range columns {
+		if table.columns[strings.ToLower(column)] {
+			continue
+		}
+		if _, err := s.tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdent(row.table), quoteIdent(column), sqliteTypeOf(values[i]))); err != nil {
+			return fmt.Errorf("failed to add column %s to %s: %w", column, row.table, err)
+		}
+		table.columns[strings.ToLower(column)] = true
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	key := strings.Join(columns, "\x00")
+	stmt, ok := table.inserts[key]
+	if !ok {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = quoteIdent(column)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		var err error
+		stmt, err = s.tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(row.table), strings.Join(quoted, ", "), placeholders))
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert into %s: %w", row.table, err)
+		}
+		table.inserts[key] = stmt
+	}
+	_, err := stmt.Exec(values...)
+	return err
+}
+
+func (s *ndjsonSQLSink) close() {
+	for _, table := range s.tables {
+		for _, stmt := range table.inserts {
+			stmt.Close()
+		}
+	}
+}
+
+// sqliteTypeOf is the column type for a column first seen with value v
+func sqliteTypeOf(v any) string {
+	switch v.(type) {
+	case int64:
+		return "INTEGER"
+	case float64:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// ndjsonMemory collects rows for the RowProvider methods
+type ndjsonMemory struct {
+	tables  []string
+	columns map[string][]string
+	rows    map[string][]map[string]any
+}
+
+func (m *ndjsonMemory) write(row *ndjsonRow) error {
+	if _, ok := m.columns[row.table]; !ok {
+		m.tables = append(m.tables, row.table)
+		m.columns[row.table] = []string{}
+	}
+	record := make(map[string]any, len(row.columns))
+	for i, column := range row.columns {
+		if _, ok := record[column]; !ok && !containsString(m.columns[row.table], column) {
+			m.columns[row.table] = append(m.columns[row.table], column)
+		}
+		record[column] = row.values[i]
+	}
+	m.rows[row.table] = append(m.rows[row.table], record)
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package flight
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/darianmavgo/banquet"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// pipelineJobPrefix prefixes the cron job id of every scheduled data_pipelines record
+const pipelineJobPrefix = "flight_pipeline_"
+
+// Values of the data_pipelines last_status field
+const (
+	PipelineStatusRunning = "running"
+	PipelineStatusSuccess = "success"
+	PipelineStatusFailed  = "failed"
+)
+
+// StartPipelineScheduler registers a cron job for every data_pipelines record with a schedule
+// and keeps the jobs in sync as pipelines are created, edited and deleted.
+func StartPipelineScheduler(app core.App) {
+	// Reject schedules the cron parser would not accept
+	app.OnRecordValidate("data_pipelines").BindFunc(func(e *core.RecordEvent) error {
+		if expr := strings.TrimSpace(e.Record.GetString("schedule")); expr != "" {
+			if _, err := cron.NewSchedule(expr); err != nil {
+				return validation.Errors{
+					"schedule": validation.NewError("validation_invalid_schedule", "Invalid cron expression: "+err.Error()),
+				}
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("data_pipelines").BindFunc(func(e *core.RecordEvent) error {
+		SchedulePipeline(e.App, e.Record)
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("data_pipelines").BindFunc(func(e *core.RecordEvent) error {
+		SchedulePipeline(e.App, e.Record)
+		return e.Next()
+	})
+	app.OnRecordAfterDeleteSuccess("data_pipelines").BindFunc(func(e *core.RecordEvent) error {
+		e.App.Cron().Remove(pipelineJobID(e.Record.Id))
+		return e.Next()
+	})
+
+	resetInterruptedPipelines(app)
+
+	pipelines, err := app.FindRecordsByFilter("data_pipelines", "schedule != ''", "", 0, 0)
+	if err != nil {
+		log.Printf("[PIPELINE] Error loading scheduled pipelines: %v", err)
+		return
+	}
+	for _, pipeline := range pipelines {
+		SchedulePipeline(app, pipeline)
+	}
+	log.Printf("[PIPELINE] Scheduled %d data pipelines", len(pipelines))
+}
+
+// resetInterruptedPipelines marks pipelines still "running" from a previous process (which
+// crashed or was stopped mid-run) as failed, so their status doesn't stay running forever.
+// Runs before any job is scheduled, when nothing of this process can be running yet.
+func resetInterruptedPipelines(app core.App) {
+	pipelines, err := app.FindRecordsByFilter("data_pipelines", "last_status = {:status}", "", 0, 0,
+		dbx.Params{"status": PipelineStatusRunning})
+	if err != nil {
+		log.Printf("[PIPELINE] Error loading interrupted pipelines: %v", err)
+		return
+	}
+
+	for _, pipeline := range pipelines {
+		pipeline.Set("last_status", PipelineStatusFailed)
+		pipeline.Set("last_error", "interrupted: Flight stopped before the run finished")
+		if err := app.Save(pipeline); err != nil {
+			log.Printf("[PIPELINE] Warning: failed to reset status of %s: %v", pipeline.GetString("name"), err)
+			continue
+		}
+		log.Printf("[PIPELINE] %s was interrupted by a restart, marked as failed", pipeline.GetString("name"))
+	}
+}
+
+// SchedulePipeline (re)registers the cron job of a pipeline, or removes it when the
+// schedule was cleared. Saving run outcomes does not touch an unchanged job.
+func SchedulePipeline(app core.App, pipeline *core.Record) {
+	jobID := pipelineJobID(pipeline.Id)
+	expr := strings.TrimSpace(pipeline.GetString("schedule"))
+
+	for _, job := range app.Cron().Jobs() {
+		if job.Id() == jobID && job.Expression() == expr {
+			return
+		}
+	}
+
+	app.Cron().Remove(jobID)
+	if expr == "" {
+		return
+	}
+
+	pipelineID := pipeline.Id
+	if err := app.Cron().Add(jobID, expr, func() {
+		runScheduledPipeline(app, pipelineID)
+	}); err != nil {
+		log.Printf("[PIPELINE] Error scheduling %s (%q): %v", pipeline.GetString("name"), expr, err)
+		return
+	}
+	log.Printf("[PIPELINE] Scheduled %s: %s", pipeline.GetString("name"), expr)
+}
+
+// pipelineJobID returns the cron job id of a pipeline record
+func pipelineJobID(pipelineID string) string {
+	return pipelineJobPrefix + pipelineID
+}
+
+// runScheduledPipeline runs a pipeline from its cron job and records the outcome on the record
+// (last_run, last_status, last_error, last_duration_ms) so failures show up in the admin UI.
+func runScheduledPipeline(app core.App, pipelineID string) {
+	pipeline, err := app.FindRecordById("data_pipelines", pipelineID)
+	if err != nil {
+		// Deleted since it was scheduled
+		app.Cron().Remove(pipelineJobID(pipelineID))
+		return
+	}
+
+	name := pipeline.GetString("name")
+	log.Printf("[PIPELINE] Running %s", name)
+
+	pipeline.Set("last_status", PipelineStatusRunning)
+	pipeline.Set("last_run", types.NowDateTime())
+	if err := app.Save(pipeline); err != nil {
+		log.Printf("[PIPELINE] Warning: failed to record start of %s: %v", name, err)
+	}
+
+	start := time.Now()
+	runErr := RunPipeline(app, pipeline)
+	duration := time.Since(start)
+
+	if runErr != nil {
+		pipeline.Set("last_status", PipelineStatusFailed)
+		pipeline.Set("last_error", runErr.Error())
+		log.Printf("[PIPELINE] %s failed after %s: %v", name, duration, runErr)
+	} else {
+		pipeline.Set("last_status", PipelineStatusSuccess)
+		pipeline.Set("last_error", "")
+		log.Printf("[PIPELINE] %s finished in %s", name, duration)
+	}
+	pipeline.Set("last_duration_ms", duration.Milliseconds())
+
+	if err := app.Save(pipeline); err != nil {
+		log.Printf("[PIPELINE] Warning: failed to record outcome of %s: %v", name, err)
+	}
+}
+
+// RunPipeline warms the cache for a pipeline's rclone_path: it fetches and converts (or indexes)
+// the dataset into the same cache location a request for it would use. A source that is
+// unchanged since the last build only renews the cache.
+func RunPipeline(app core.App, pipeline *core.Record) error {
+	datasetPath := pipeline.GetString("rclone_path")
+	remoteID := pipeline.GetString("rclone_remote")
+	if remoteID == "" {
+		return runLocalPipeline(app, datasetPath)
+	}
+
+	remoteRecord, err := app.FindRecordById("rclone_remotes", remoteID)
+	if err != nil {
+		return fmt.Errorf("failed to find remote %s: %w", remoteID, err)
+	}
+
+	rcloneManager := GetRcloneManager()
+	if rcloneManager == nil {
+		return fmt.Errorf("rclone manager not initialized")
+	}
+
+	vfsRecord, err := ResolveRemote(app, remoteRecord)
+	if err != nil {
+		return fmt.Errorf("failed to resolve remote %s: %w", remoteRecord.GetString("name"), err)
+	}
+
+	vfs, releaseVFS, err := rcloneManager.AcquireVFS(vfsRecord)
+	if err != nil {
+		return fmt.Errorf("failed to initialize VFS: %w", err)
+	}
+	defer releaseVFS()
+
+	// Parse the URL a user would request so the cache key matches HandleBanquet
+	rawURL := fmt.Sprintf("%s://%s/%s", remoteRecord.GetString("type"), remoteRecord.GetString("name"), strings.TrimPrefix(datasetPath, "/"))
+	b, err := banquet.ParseBanquet(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline path %q: %w", datasetPath, err)
+	}
+	ExpandArchivePath(b)
+	if err := resolveRemoteArchiveMember(app, rcloneManager, vfs, remoteRecord, b); err != nil {
+		return err
+	}
+
+	cacheKey := GenCacheKey(b)
+	cachePath := GetCachePath(app.DataDir(), cacheKey)
+
+	release := AcquireCache(cachePath)
+	defer release()
+
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+	node, err := rcloneManager.Stat(vfs, archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to access remote path %s: %w", b.DataSetPath, err)
+	}
+
+	convert := ResolveConvertOptions(app, remoteRecord, b.DataSetPath)
+	fingerprint := NodeFingerprint(node)
+	fingerprint.Convert = convert.Hash()
+	if !node.IsDir() && SourceUnchanged(cachePath, fingerprint) {
+		log.Printf("[PIPELINE] Source %s unchanged (%s), renewing cache", b.DataSetPath, fingerprint)
+		return RenewCache(cachePath)
+	}
+
+	build := &remoteBuild{
+		App:          app,
+		Rclone:       rcloneManager,
+		VFS:          vfs,
+		RemoteRecord: remoteRecord,
+		DataSetPath:  b.DataSetPath,
+		EntryPath:    entryPath,
+		ArchiveKey:   archiveCacheKey(b, archivePath),
+		FetchPath:    archivePath,
+		SourceURL:    datasetURL(b),
+		CacheKey:     cacheKey,
+		CachePath:    cachePath,
+		Convert:      convert,
+	}
+	_, err = cacheBuilds.Do(cacheKey, cacheBuildWait, func() error {
+		return build.Run(node)
+	})
+	return err
+}
+
+// runLocalPipeline warms the cache of a local dataset (pipelines without a remote)
+func runLocalPipeline(app core.App, datasetPath string) error {
+	// Parsed like a request for it, so cache_entries records the same source_url
+	b, err := banquet.ParseNested(datasetPath)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline path %q: %w", datasetPath, err)
+	}
+	ExpandArchivePath(b)
+
+	archivePath, entryPath := SplitArchivePath(b.DataSetPath)
+	localFilePath := ResolveLocalPath(app, archivePath)
+	info, err := os.Stat(localFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to access local path: %w", err)
+	}
+	// The archive's listing tells zip members from folders and tables, as in HandleLocalDataset
+	if entryPath != "" && !info.IsDir() {
+		if err := ResolveArchiveMember(b, localFilePath); err != nil {
+			return err
+		}
+		_, entryPath = SplitArchivePath(b.DataSetPath)
+	}
+
+	cacheKey, cachePath := localCacheLocation(app, filepath.Join(localFilePath, entryPath), info.IsDir())
+	release := AcquireCache(cachePath)
+	defer release()
+
+	build := &localBuild{
+		App:       app,
+		LocalPath: localFilePath,
+		EntryPath: entryPath,
+		Info:      info,
+		SourceURL: datasetURL(b),
+		CacheKey:  cacheKey,
+		CachePath: cachePath,
+		Convert:   ResolveConvertOptions(app, nil, b.DataSetPath),
+	}
+	if fingerprint := build.Fingerprint(); !info.IsDir() && SourceUnchanged(cachePath, fingerprint) {
+		log.Printf("[PIPELINE] Source %s unchanged (%s), renewing cache", b.DataSetPath, fingerprint)
+		return RenewCache(cachePath)
+	}
+	_, err = cacheBuilds.Do(cacheKey, cacheBuildWait, build.Run)
+	return err
+}
@@ -0,0 +1,57 @@
+package flight
+
+import (
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// FindPipeline returns the data_pipelines record that covers datasetPath on the given remote.
+// A pipeline matches when its rclone_path equals datasetPath or is a parent folder of it;
+// the longest (most specific) rclone_path wins. Local datasets match pipelines without a remote.
+// Returns nil when no pipeline applies.
+func FindPipeline(app core.App, remoteRecord *core.Record, datasetPath string) *core.Record {
+	// An empty relation only matches the literal '', not an empty placeholder value
+	filter, params := "rclone_remote = ''", map[string]interface{}{}
+	if remoteRecord != nil {
+		if remoteRecord.IsNew() {
+			// Ad-hoc remotes (e.g. plain HTTP hosts) are never saved, so no pipeline can reference them
+			return nil
+		}
+		filter, params = "rclone_remote = {:remote}", map[string]interface{}{"remote": remoteRecord.Id}
+	}
+
+	pipelines, err := app.FindRecordsByFilter("data_pipelines", filter, "", 0, 0, params)
+	if err != nil {
+		return nil
+	}
+
+	target := normalizePipelinePath(datasetPath)
+	var best *core.Record
+	bestLen := -1
+	for _, p := range pipelines {
+		prefix := normalizePipelinePath(p.GetString("rclone_path"))
+		if !pathHasPrefix(target, prefix) {
+			continue
+		}
+		if len(prefix) > bestLen {
+			best = p
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
+
+// normalizePipelinePath strips leading and trailing slashes so "/a/b/" and "a/b" compare equal
+func normalizePipelinePath(p string) string {
+	return strings.Trim(p, "/")
+}
+
+// pathHasPrefix reports whether prefix is p itself or one of its parent folders.
+// An empty prefix matches everything.
+func pathHasPrefix(p, prefix string) bool {
+	if prefix == "" || p == prefix {
+		return true
+	}
+	return strings.HasPrefix(p, prefix+"/")
+}
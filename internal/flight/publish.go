@@ -0,0 +1,101 @@
+package flight
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildingSuffix marks databases that are still being built; see publishAtomically
+const buildingSuffix = ".building"
+
+// publishAtomically builds destPath without ever exposing a partial database.
+// build writes a complete SQLite database to tmpPath, a hidden sibling of destPath
+// (same directory, so the final rename is atomic). The result must pass an SQLite
+// quick_check before it replaces destPath; on any failure destPath is left untouched.
+func publishAtomically(destPath string, build func(tmpPath string) error) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(destPath),
+		fmt.Sprintf(".%s.%d%s", filepath.Base(destPath), time.Now().UnixNano(), buildingSuffix))
+	release := AcquireCache(tmpPath)
+	defer release()
+	defer removeSQLiteFiles(tmpPath) // no-op after a successful rename, except for stray journals
+
+	if err := build(tmpPath); err != nil {
+		return err
+	}
+
+	if err := checkSQLiteIntegrity(tmpPath); err != nil {
+		return fmt.Errorf("built database failed integrity check: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("failed to publish database: %w", err)
+	}
+	return nil
+}
+
+// checkSQLiteIntegrity runs PRAGMA quick_check, which verifies the file is a readable,
+// structurally sound SQLite database without the cost of a full integrity_check index scan.
+func checkSQLiteIntegrity(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("quick_check: %s", result)
+	}
+	return nil
+}
+
+// removeSQLiteFiles removes a database file together with any journal files SQLite left next to it
+func removeSQLiteFiles(path string) {
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+}
+
+// CleanupStaleBuilds removes unfinished databases left in dir by interrupted builds
+// (e.g. a crash mid-conversion). Builds still running in this process are skipped.
+func CleanupStaleBuilds(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, ".") {
+			continue
+		}
+		// Journals of a stale build share its name plus a suffix
+		base := name
+		for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+			base = strings.TrimSuffix(base, suffix)
+		}
+		if !strings.HasSuffix(base, buildingSuffix) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if isCacheLeased(filepath.Join(dir, base)) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			log.Printf("[CACHE] Removed stale partial build %s", name)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,27 +17,54 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/vfs"
-	"github.com/rclone/rclone/vfs/vfscommon"
+
+	// Local remotes, read in place (see LocalPath)
+	_ "github.com/rclone/rclone/backend/local"
 )
 
 // RcloneManager manages VFS instances and caching
 type RcloneManager struct {
-	vfsCache map[string]*vfs.VFS
+	vfsCache map[string]*vfsEntry
+	retired  map[*vfs.VFS]*vfsEntry // dropped by DropRemoteVFS but still in use
 	cacheDir string
-	mu       sync.RWMutex
+	mu       sync.Mutex
+
+	// Lifecycle limits, see SetVFSLimits
+	idleTimeout  time.Duration
+	maxInstances int
 }
 
+// vfsEntry is a live VFS with the number of requests and builds using it
+type vfsEntry struct {
+	vfs      *vfs.VFS
+	hash     string // vfsCache key, see vfsCacheKey
+	remoteID string // rclone_remotes record id, "" for ad-hoc remotes
+	refs     int
+	lastUsed time.Time
+}
+
+// ErrVFSLimit is returned by AcquireVFS when the maximum number of VFS instances is live
+// and all of them are in use
+var ErrVFSLimit = errors.New("too many remotes in use")
+
 var globalRcloneManager *RcloneManager
 
-// InitRclone initializes the global rclone manager
+// InitRclone initializes the global rclone manager. VFS instances of a previous manager
+// are shut down.
 func InitRclone(cacheDir string) error {
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
+	if globalRcloneManager != nil {
+		globalRcloneManager.Shutdown()
+	}
 	globalRcloneManager = &RcloneManager{
-		vfsCache: make(map[string]*vfs.VFS),
-		cacheDir: cacheDir,
+		vfsCache:     make(map[string]*vfsEntry),
+		retired:      make(map[*vfs.VFS]*vfsEntry),
+		cacheDir:     cacheDir,
+		idleTimeout:  defaultVFSIdleTimeout,
+		maxInstances: defaultVFSMaxInstances,
 	}
 
 	log.Printf("[RCLONE] Initialized with cache directory: %s", cacheDir)
@@ -48,109 +76,312 @@ func GetRcloneManager() *RcloneManager {
 	return globalRcloneManager
 }
 
-// generateVFSHash creates a unique hash for VFS caching based on remote config
-func generateVFSHash(remoteConfig map[string]interface{}) string {
-	// Serialize config to JSON for consistent hashing
-	configJSON, err := json.Marshal(remoteConfig)
+// generateVFSHash creates a unique hash for VFS caching based on remote config, root and VFS settings
+func generateVFSHash(remoteConfig map[string]interface{}, root string, vfsSettings map[string]interface{}) string {
+	// Serialize to JSON (map keys sorted) for consistent hashing
+	configJSON, err := json.Marshal([]interface{}{remoteConfig, root, vfsSettings})
 	if err != nil {
 		log.Printf("[RCLONE] Warning: failed to marshal config for hashing: %v", err)
-		return fmt.Sprintf("%v", remoteConfig)
+		return fmt.Sprintf("%v %q %v", remoteConfig, root, vfsSettings)
 	}
 
 	hash := md5.Sum(configJSON)
 	return fmt.Sprintf("%x", hash)
 }
 
-// GetVFS gets or creates a VFS instance for the given remote configuration
-func (rm *RcloneManager) GetVFS(remoteRecord *core.Record) (*vfs.VFS, error) {
-	// Extract configuration from PocketBase record
-	remoteType := remoteRecord.GetString("type")
-	configData := remoteRecord.Get("config")
+// vfsCacheKey identifies the VFS of a remote record: its id (ad-hoc remotes are unsaved)
+// plus a fingerprint of the type, config, root and vfs_settings it was created with, so
+// editing any of them gets a new instance
+func vfsCacheKey(remoteRecord *core.Record, src remoteSource, vfsSettings map[string]interface{}) string {
+	id := remoteRecordID(remoteRecord)
+	if id == "" {
+		id = "adhoc"
+	}
+	return id + "-" + src.Type + "-" + generateVFSHash(src.Config, src.Root, vfsSettings)
+}
 
-	var config map[string]interface{}
-	switch v := configData.(type) {
+// jsonFieldMap decodes the value of a JSON record field (config, vfs_settings) into a map.
+// Unset fields give a nil map.
+func jsonFieldMap(data interface{}) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
 	case map[string]interface{}:
-		config = v
+		m = v
 	case string:
-		if err := json.Unmarshal([]byte(v), &config); err != nil {
-			return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+		if v == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
 		}
 	case []byte:
-		// Handle types.JSONRaw (which is []byte under the hood)
-		if err := json.Unmarshal(v, &config); err != nil {
-			return nil, fmt.Errorf("failed to parse config JSON from bytes: %w", err)
+		if len(v) == 0 {
+			return nil, nil
+		}
+		if err := json.Unmarshal(v, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON from bytes: %w", err)
 		}
 	default:
 		// Try to marshal and unmarshal as a fallback for types.JSONRaw
-		jsonBytes, err := json.Marshal(configData)
+		jsonBytes, err := json.Marshal(data)
 		if err != nil {
-			return nil, fmt.Errorf("invalid config type: %T", configData)
+			return nil, fmt.Errorf("invalid JSON type: %T", data)
 		}
-		if err := json.Unmarshal(jsonBytes, &config); err != nil {
-			return nil, fmt.Errorf("failed to parse config JSON from type %T: %w", configData, err)
+		if err := json.Unmarshal(jsonBytes, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON from type %T: %w", data, err)
 		}
 	}
+	return m, nil
+}
 
-	// Generate hash for this configuration
-	configHash := generateVFSHash(config)
+// GetVFS gets or creates a VFS instance for the given remote configuration.
+// The instance is not leased and may be evicted once idle; requests and builds use AcquireVFS.
+func (rm *RcloneManager) GetVFS(remoteRecord *core.Record) (*vfs.VFS, error) {
+	v, release, err := rm.AcquireVFS(remoteRecord)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return v, nil
+}
 
-	// Check if VFS already exists in cache
-	rm.mu.RLock()
-	if existingVFS, ok := rm.vfsCache[configHash]; ok {
-		rm.mu.RUnlock()
-		log.Printf("[RCLONE] VFS cache hit for hash: %s", configHash)
-		return existingVFS, nil
+// AcquireVFS gets or creates the VFS instance for a remote and marks it as in use, so idle
+// eviction and the instance cap never shut it down. The returned function releases the
+// lease and must be called exactly once. When the cap is reached, the least recently used
+// idle instance is shut down to make room; ErrVFSLimit is returned if none is idle.
+func (rm *RcloneManager) AcquireVFS(remoteRecord *core.Record) (*vfs.VFS, func(), error) {
+	// Extract configuration from PocketBase record
+	src, err := recordSource(remoteRecord)
+	if err != nil {
+		return nil, nil, err
 	}
-	rm.mu.RUnlock()
+	vfsSettings, err := jsonFieldMap(remoteRecord.Get("vfs_settings"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid vfs_settings: %w", err)
+	}
+	vfsOpts, err := vfsOptions(remoteRecord)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid vfs_settings: %w", err)
+	}
+
+	// Key for this remote and configuration
+	configHash := vfsCacheKey(remoteRecord, src, vfsSettings)
 
-	// Create new VFS instance
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
-	// Double-check after acquiring write lock
-	if existingVFS, ok := rm.vfsCache[configHash]; ok {
-		return existingVFS, nil
+	// Check if VFS already exists in cache
+	if entry, ok := rm.vfsCache[configHash]; ok {
+		log.Printf("[RCLONE] VFS cache hit for hash: %s", configHash)
+		return entry.vfs, rm.lease(entry), nil
+	}
+
+	// Make room under the cap before creating another instance
+	if rm.maxInstances > 0 && len(rm.vfsCache) >= rm.maxInstances {
+		victim := rm.leastRecentlyUsedIdle()
+		if victim == nil {
+			return nil, nil, fmt.Errorf("%w: all %d VFS instances are busy", ErrVFSLimit, len(rm.vfsCache))
+		}
+		delete(rm.vfsCache, victim.hash)
+		log.Printf("[RCLONE] VFS limit of %d reached, shutting down least recently used %s", rm.maxInstances, victim.hash)
+		shutdownVFS(victim)
 	}
 
-	log.Printf("[RCLONE] Creating new VFS for type: %s, hash: %s", remoteType, configHash)
+	log.Printf("[RCLONE] Creating new VFS for type: %s, root: %q, hash: %s", src.Type, src.Root, configHash)
 
 	// Create rclone filesystem
-	f, err := rm.createFilesystem(remoteType, config)
+	f, err := rm.createFilesystem(src)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create filesystem: %w", err)
+		return nil, nil, fmt.Errorf("failed to create filesystem: %w", err)
 	}
 
-	// Get VFS settings (use defaults or from record)
-	vfsOpts := rm.getVFSOptions(remoteRecord)
+	// Create and cache the VFS instance
+	entry := &vfsEntry{vfs: vfs.New(f, &vfsOpts), hash: configHash, remoteID: remoteRecordID(remoteRecord)}
+	rm.vfsCache[configHash] = entry
 
-	// Create VFS instance
-	newVFS := vfs.New(f, &vfsOpts)
+	log.Printf("[RCLONE] VFS created and cached for hash: %s", configHash)
+	return entry.vfs, rm.lease(entry), nil
+}
 
-	// Cache the VFS instance
-	rm.vfsCache[configHash] = newVFS
+// retainVFS takes another lease on an instance returned by AcquireVFS, for work that
+// outlives the request that acquired it (background refreshes)
+func (rm *RcloneManager) retainVFS(v *vfs.VFS) func() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for _, entry := range rm.vfsCache {
+		if entry.vfs == v {
+			return rm.lease(entry)
+		}
+	}
+	if entry, ok := rm.retired[v]; ok {
+		return rm.lease(entry)
+	}
+	return func() {}
+}
 
-	log.Printf("[RCLONE] VFS created and cached for hash: %s", configHash)
-	return newVFS, nil
+// lease counts a user of entry; rm.mu must be held
+func (rm *RcloneManager) lease(entry *vfsEntry) func() {
+	entry.refs++
+	entry.lastUsed = time.Now()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			rm.mu.Lock()
+			entry.refs--
+			entry.lastUsed = time.Now()
+			shutdown := rm.retired[entry.vfs] == entry && entry.refs == 0
+			if shutdown {
+				delete(rm.retired, entry.vfs)
+			}
+			rm.mu.Unlock()
+
+			if shutdown {
+				log.Printf("[RCLONE] Shutting down retired VFS %s after its last use", entry.hash)
+				shutdownVFS(entry)
+			}
+		})
+	}
 }
 
-// createFilesystem creates an rclone filesystem from type and config
-func (rm *RcloneManager) createFilesystem(remoteType string, config map[string]interface{}) (fs.Fs, error) {
+// DropRemoteVFS removes the VFS instances of a remote record, so the next request creates
+// one from the record's current settings. Idle instances are shut down right away, those
+// in use once their last lease is released. Returns the number of instances dropped.
+func (rm *RcloneManager) DropRemoteVFS(remoteID string) int {
+	if remoteID == "" {
+		return 0
+	}
+
+	rm.mu.Lock()
+	var idle []*vfsEntry
+	dropped := 0
+	for hash, entry := range rm.vfsCache {
+		if entry.remoteID != remoteID {
+			continue
+		}
+		delete(rm.vfsCache, hash)
+		dropped++
+		if entry.refs > 0 {
+			rm.retired[entry.vfs] = entry
+		} else {
+			idle = append(idle, entry)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, entry := range idle {
+		shutdownVFS(entry)
+	}
+	if dropped > 0 {
+		log.Printf("[RCLONE] Dropped %d VFS instances of remote %s", dropped, remoteID)
+	}
+	return dropped
+}
+
+// leastRecentlyUsedIdle returns the idle instance unused for the longest time, nil if all
+// are in use; rm.mu must be held
+func (rm *RcloneManager) leastRecentlyUsedIdle() *vfsEntry {
+	var victim *vfsEntry
+	for _, entry := range rm.vfsCache {
+		if entry.refs == 0 && (victim == nil || entry.lastUsed.Before(victim.lastUsed)) {
+			victim = entry
+		}
+	}
+	return victim
+}
+
+// SetVFSLimits sets how long an unused VFS instance stays live and how many instances may
+// be live at once. Zero disables the respective limit.
+func (rm *RcloneManager) SetVFSLimits(idleTimeout time.Duration, maxInstances int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.idleTimeout = idleTimeout
+	rm.maxInstances = maxInstances
+}
+
+// VFSCount returns the number of live VFS instances
+func (rm *RcloneManager) VFSCount() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return len(rm.vfsCache)
+}
+
+// EvictIdleVFS shuts down the instances that are not in use and were last used longer than
+// the idle timeout ago. Returns the number of instances shut down.
+func (rm *RcloneManager) EvictIdleVFS() int {
+	rm.mu.Lock()
+	if rm.idleTimeout <= 0 {
+		rm.mu.Unlock()
+		return 0
+	}
+	var idle []*vfsEntry
+	for hash, entry := range rm.vfsCache {
+		if entry.refs == 0 && time.Since(entry.lastUsed) >= rm.idleTimeout {
+			idle = append(idle, entry)
+			delete(rm.vfsCache, hash)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, entry := range idle {
+		log.Printf("[RCLONE] Shutting down idle VFS %s (unused since %s)", entry.hash, entry.lastUsed.Format(time.RFC3339))
+		shutdownVFS(entry)
+	}
+	return len(idle)
+}
+
+// Shutdown shuts down every VFS instance, in use or not, when the app terminates
+func (rm *RcloneManager) Shutdown() {
+	rm.mu.Lock()
+	var entries []*vfsEntry
+	for _, entry := range rm.vfsCache {
+		entries = append(entries, entry)
+	}
+	for _, entry := range rm.retired {
+		entries = append(entries, entry)
+	}
+	rm.vfsCache = make(map[string]*vfsEntry)
+	rm.retired = make(map[*vfs.VFS]*vfsEntry)
+	rm.mu.Unlock()
+
+	for _, entry := range entries {
+		shutdownVFS(entry)
+	}
+	if len(entries) > 0 {
+		log.Printf("[RCLONE] Shut down %d VFS instances", len(entries))
+	}
+}
+
+// shutdownVFS stops an instance's background work and removes its VFS cache files
+func shutdownVFS(entry *vfsEntry) {
+	entry.vfs.Shutdown()
+	if err := entry.vfs.CleanUp(); err != nil {
+		log.Printf("[RCLONE] Warning: failed to clean up VFS cache of %s: %v", entry.hash, err)
+	}
+}
+
+// createFilesystem creates an rclone filesystem from type, config and root
+func (rm *RcloneManager) createFilesystem(src remoteSource) (fs.Fs, error) {
 	// Convert config map to configmap.Simple
 	m := configmap.Simple{}
-	for k, v := range config {
+	for k, v := range src.Config {
 		m[k] = fmt.Sprintf("%v", v)
 	}
 
 	// Find the filesystem registry info
-	fsInfo, err := fs.Find(remoteType)
+	fsInfo, err := fs.Find(src.Type)
 	if err != nil {
-		return nil, fmt.Errorf("unknown remote type '%s': %w", remoteType, err)
+		return nil, fmt.Errorf("unknown remote type '%s': %w", src.Type, err)
 	}
 
-	// Create the filesystem
-	// The path is typically empty or "/" for root access
+	// Create the filesystem, scoped to the root when set
 	ctx := context.Background()
-	f, err := fsInfo.NewFs(ctx, "", "", m)
+	f, err := fsInfo.NewFs(ctx, "", src.Root, m)
+	if errors.Is(err, fs.ErrorIsFile) {
+		return nil, fmt.Errorf("root %q is a file, not a directory", src.Root)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create filesystem: %w", err)
 	}
@@ -158,53 +389,6 @@ func (rm *RcloneManager) createFilesystem(remoteType string, config map[string]i
 	return f, nil
 }
 
-// getVFSOptions returns VFS options, using defaults or custom settings from record
-func (rm *RcloneManager) getVFSOptions(remoteRecord *core.Record) vfscommon.Options {
-	opts := vfscommon.Options{
-		CacheMode:         vfscommon.CacheModeFull, // Critical for random access
-		DirCacheTime:      10 * 60,                 // 10 minutes
-		CacheMaxAge:       24 * 60 * 60,            // 24 hours
-		CachePollInterval: 60,                      // 1 minute
-		ChunkSize:         128 * 1024 * 1024,       // 128 MB
-		ReadAhead:         0,                       // Disable read-ahead by default
-	}
-
-	// Check for custom VFS settings in the record
-	vfsSettingsData := remoteRecord.Get("vfs_settings")
-	if vfsSettingsData != nil {
-		var customSettings map[string]interface{}
-		switch v := vfsSettingsData.(type) {
-		case map[string]interface{}:
-			customSettings = v
-		case string:
-			if err := json.Unmarshal([]byte(v), &customSettings); err != nil {
-				log.Printf("[RCLONE] Warning: failed to parse vfs_settings: %v", err)
-				return opts
-			}
-		}
-
-		// Apply custom settings if present
-		if cacheMode, ok := customSettings["cache_mode"].(string); ok {
-			switch cacheMode {
-			case "off":
-				opts.CacheMode = vfscommon.CacheModeOff
-			case "minimal":
-				opts.CacheMode = vfscommon.CacheModeMinimal
-			case "writes":
-				opts.CacheMode = vfscommon.CacheModeWrites
-			case "full":
-				opts.CacheMode = vfscommon.CacheModeFull
-			}
-		}
-
-		if chunkSize, ok := customSettings["chunk_size"].(float64); ok {
-			opts.ChunkSize = fs.SizeSuffix(chunkSize)
-		}
-	}
-
-	return opts
-}
-
 // LookupRemote queries PocketBase for remote configuration by hostname
 func LookupRemote(app core.App, hostname string) (*core.Record, error) {
 	record, err := app.FindFirstRecordByFilter(
@@ -226,36 +410,60 @@ func (rm *RcloneManager) Stat(v *vfs.VFS, remotePath string) (vfs.Node, error) {
 }
 
 // FetchFile downloads a file from remote to local cache using VFS
-func (rm *RcloneManager) FetchFile(v *vfs.VFS, remotePath string, localCachePath string) error {
+func (rm *RcloneManager) FetchFile(v *vfs.VFS, remotePath string, localCachePath string) (contentType string, err error) {
 	log.Printf("[RCLONE] Fetching file: %s -> %s", remotePath, localCachePath)
 
 	// Ensure local cache directory exists
 	if err := os.MkdirAll(filepath.Dir(localCachePath), 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Open remote file via VFS
-	remoteFile, err := v.OpenFile(remotePath, os.O_RDONLY, 0)
+	remoteFile, contentType, err := rm.OpenFile(v, remotePath)
 	if err != nil {
-		return fmt.Errorf("failed to open remote file: %w", err)
+		return "", err
 	}
 	defer remoteFile.Close()
 
 	// Create local file
 	localFile, err := os.Create(localCachePath)
 	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+		return "", fmt.Errorf("failed to create local file: %w", err)
 	}
 	defer localFile.Close()
 
 	// Copy contents (VFS handles caching internally with CacheModeFull)
 	written, err := localFile.ReadFrom(remoteFile)
 	if err != nil {
-		return fmt.Errorf("failed to copy file contents: %w", err)
+		return "", fmt.Errorf("failed to copy file contents: %w", err)
 	}
 
-	log.Printf("[RCLONE] Fetched %d bytes successfully", written)
-	return nil
+	log.Printf("[RCLONE] Fetched %d bytes successfully (Content-Type %q)", written, contentType)
+	return contentType, nil
+}
+
+// OpenFile opens a remote file for reading via VFS, for converting it as a stream.
+// The caller closes the handle.
+func (rm *RcloneManager) OpenFile(v *vfs.VFS, remotePath string) (handle vfs.Handle, contentType string, err error) {
+	handle, err = v.OpenFile(remotePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open remote file: %w", err)
+	}
+
+	// Content-Type as reported by the backend (e.g. the HTTP header), used for content detection.
+	// Not fs.MimeType, which falls back to guessing from the extension.
+	if mimeTyper, ok := handle.Node().DirEntry().(fs.MimeTyper); ok {
+		contentType = mimeTyper.MimeType(context.Background())
+	}
+	return handle, contentType, nil
+}
+
+// LocalPath returns where a file of a local remote lives on disk, so it can be read in
+// place. ok is false for every other backend.
+func (rm *RcloneManager) LocalPath(v *vfs.VFS, remotePath string) (localPath string, ok bool) {
+	if !v.Fs().Features().IsLocal {
+		return "", false
+	}
+	return filepath.Join(filepath.FromSlash(v.Fs().Root()), filepath.FromSlash(remotePath)), true
 }
 
 // IndexDirectory creates a SQLite database containing the listing of a remote directory
@@ -268,33 +476,6 @@ func (rm *RcloneManager) IndexDirectory(v *vfs.VFS, remotePath string, localCach
 		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Open/Create SQLite database
-	// We use the same name "tb0" and same columns as mksqlite filesystem converter
-	db, err := sql.Open("sqlite", localCachePath)
-	if err != nil {
-		return fmt.Errorf("failed to open cache database: %w", err)
-	}
-	defer db.Close()
-
-	// Create table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS tb0 (
-		path TEXT,
-		name TEXT,
-		size TEXT,
-		extension TEXT,
-		mod_time TEXT,
-		is_dir TEXT
-	)`)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
-	}
-
-	// Clear existing data (if any)
-	_, err = db.Exec("DELETE FROM tb0")
-	if err != nil {
-		return fmt.Errorf("failed to clear table: %w", err)
-	}
-
 	// Get directory node
 	node, err := v.Stat(remotePath)
 	if err != nil {
@@ -312,30 +493,58 @@ func (rm *RcloneManager) IndexDirectory(v *vfs.VFS, remotePath string, localCach
 		return fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	// Prepare insert statement
-	stmt, err := db.Prepare("INSERT INTO tb0 (path, name, size, extension, mod_time, is_dir) VALUES (?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
-	}
-	defer stmt.Close()
+	// Build a fresh database next to the cache file and swap it in once complete,
+	// so readers never see an empty or half-filled listing
+	err = publishAtomically(localCachePath, func(tmpPath string) error {
+		// We use the same name "tb0" and same columns as mksqlite filesystem converter
+		db, err := sql.Open("sqlite", tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to open cache database: %w", err)
+		}
+		defer db.Close()
 
-	// Insert entries
-	for _, entry := range entries {
-		name := entry.Name()
-		relPath := filepath.Join(remotePath, name)
-		size := fmt.Sprintf("%d", entry.Size())
-		ext := filepath.Ext(name)
-		modTime := entry.ModTime().Format(time.RFC3339)
-		isDir := "0"
-		if entry.IsDir() {
-			isDir = "1"
-			size = "0" // Traditionally 0 or entry count for dirs in some tools, mksqlite uses size
+		// Create table
+		_, err = db.Exec(listingTableSQL)
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
 		}
+		defer tx.Rollback()
 
-		_, err = stmt.Exec(relPath, name, size, ext, modTime, isDir)
+		// Prepare insert statement
+		stmt, err := tx.Prepare("INSERT INTO tb0 (path, name, size, extension, mod_time, is_dir) VALUES (?, ?, ?, ?, ?, ?)")
 		if err != nil {
-			log.Printf("[RCLONE] Warning: failed to index entry %s: %v", name, err)
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		// Insert entries
+		for _, entry := range entries {
+			name := entry.Name()
+			relPath := filepath.Join(remotePath, name)
+			size := entry.Size()
+			ext := filepath.Ext(name)
+			modTime := entry.ModTime().Format(time.RFC3339)
+			isDir := 0
+			if entry.IsDir() {
+				isDir = 1
+				size = 0 // Traditionally 0 or entry count for dirs in some tools, mksqlite uses size
+			}
+
+			_, err = stmt.Exec(relPath, name, size, ext, modTime, isDir)
+			if err != nil {
+				log.Printf("[RCLONE] Warning: failed to index entry %s: %v", name, err)
+			}
 		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("[RCLONE] Indexed %d entries successfully", len(entries))
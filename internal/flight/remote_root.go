@@ -0,0 +1,190 @@
+package flight
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+// remoteSource is what the filesystem of a remote is created from
+type remoteSource struct {
+	Type   string
+	Config map[string]interface{}
+	Root   string // path inside the backend, "" for its top level
+}
+
+// errNamedRoot is returned by recordSource for a root naming another remote, which only
+// ResolveRemote can look up
+var errNamedRoot = errors.New("root names another remote")
+
+// remoteFieldError is an error in the source of a remote record, tied to the field causing it
+type remoteFieldError struct {
+	field string
+	err   error
+}
+
+func (e *remoteFieldError) Error() string { return e.err.Error() }
+func (e *remoteFieldError) Unwrap() error { return e.err }
+
+// fieldErrorf returns a remoteFieldError for field, formatted as by fmt.Errorf
+func fieldErrorf(field, format string, args ...any) error {
+	return &remoteFieldError{field: field, err: fmt.Errorf(format, args...)}
+}
+
+// remoteErrorField returns the record field an error of ResolveRemote or recordSource
+// comes from, "root" when it isn't tied to one
+func remoteErrorField(err error) string {
+	var fieldErr *remoteFieldError
+	if errors.As(err, &fieldErr) {
+		return fieldErr.field
+	}
+	return "root"
+}
+
+// remoteRoot returns the root of a remote record: the root field, or the "root" key of
+// config that older records use. The returned config is a copy without that key.
+func remoteRoot(record *core.Record, config map[string]interface{}) (string, map[string]interface{}) {
+	root := strings.TrimSpace(record.GetString("root"))
+	copied := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		copied[k] = v
+	}
+	if legacy, ok := copied["root"].(string); ok {
+		delete(copied, "root")
+		if root == "" {
+			root = strings.TrimSpace(legacy)
+		}
+	}
+	return root, copied
+}
+
+// recordSource returns the source of a remote record. The root is a path inside the
+// backend ("analytics/public") or an rclone connection string for the record's own backend
+// with on-the-fly options (":s3,acl=private:analytics/public"), which override config.
+func recordSource(record *core.Record) (remoteSource, error) {
+	config, err := jsonFieldMap(record.Get("config"))
+	if err != nil {
+		return remoteSource{}, fieldErrorf("config", "invalid config: %w", err)
+	}
+	root, config := remoteRoot(record, config)
+	src := remoteSource{Type: record.GetString("type"), Config: config}
+	if root == "" {
+		return src, nil
+	}
+
+	parsed, err := fspath.Parse(root)
+	if err != nil {
+		return src, fieldErrorf("root", "invalid root %q: %w", root, err)
+	}
+	if parsed.Name != "" && !strings.HasPrefix(parsed.Name, ":") {
+		return src, fmt.Errorf("%w: %q", errNamedRoot, root)
+	}
+	if backend := strings.TrimPrefix(parsed.Name, ":"); backend != "" && backend != src.Type {
+		return src, fieldErrorf("root", "root %q is a %s backend but the remote type is %s", root, backend, src.Type)
+	}
+	for k, v := range parsed.Config {
+		src.Config[k] = v
+	}
+	src.Root = parsed.Path
+	return src, nil
+}
+
+// ResolveRemote returns the record to create a remote's VFS from. A root naming another
+// remote ("r2:analytics/public") scopes this remote into that one: the result is a copy
+// of the record with the named remote's type and config, overlaid with the record's own
+// config and on-the-fly options, and the root joined below the named remote's root. Any
+// other record is returned as is.
+func ResolveRemote(app core.App, record *core.Record) (*core.Record, error) {
+	if _, err := recordSource(record); !errors.Is(err, errNamedRoot) {
+		return record, err
+	}
+	src, err := resolveSource(app, record, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := record.Clone()
+	resolved.Set("type", src.Type)
+	resolved.Set("config", src.Config)
+	resolved.Set("root", src.Root)
+	return resolved, nil
+}
+
+// resolveSource returns the source of a record, following roots that name other remotes
+func resolveSource(app core.App, record *core.Record, seen map[string]bool) (remoteSource, error) {
+	src, err := recordSource(record)
+	if !errors.Is(err, errNamedRoot) {
+		return src, err
+	}
+
+	config, _ := jsonFieldMap(record.Get("config"))
+	root, config := remoteRoot(record, config)
+	parsed, _ := fspath.Parse(root)
+
+	seen[record.GetString("name")] = true
+	if seen[parsed.Name] {
+		return src, fieldErrorf("root", "root %q refers back to remote %q", root, parsed.Name)
+	}
+	baseRecord, err := app.FindFirstRecordByData("rclone_remotes", "name", parsed.Name)
+	if err != nil {
+		return src, fieldErrorf("root", "root %q refers to unknown remote %q", root, parsed.Name)
+	}
+	base, err := resolveSource(app, baseRecord, seen)
+	if err != nil {
+		// The named remote is broken, not this record's config
+		return src, fieldErrorf("root", "remote %q: %w", parsed.Name, err)
+	}
+	if src.Type != base.Type {
+		return src, fieldErrorf("type", "type %s doesn't match type %s of remote %q", src.Type, base.Type, parsed.Name)
+	}
+
+	for k, v := range config {
+		base.Config[k] = v
+	}
+	for k, v := range parsed.Config {
+		base.Config[k] = v
+	}
+	if base.Root != "" && parsed.Path != "" {
+		base.Root = path.Join(base.Root, parsed.Path)
+	} else if parsed.Path != "" {
+		base.Root = parsed.Path
+	}
+	return base, nil
+}
+
+// dependentRemotes returns the remotes whose root names one of names, directly or
+// through other remotes
+func dependentRemotes(app core.App, names ...string) ([]*core.Record, error) {
+	remotes, err := app.FindAllRecords("rclone_remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	pending := append([]string(nil), names...)
+	seen := map[string]bool{}
+	var dependents []*core.Record
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		for _, remote := range remotes {
+			config, _ := jsonFieldMap(remote.Get("config"))
+			root, _ := remoteRoot(remote, config)
+			parsed, err := fspath.Parse(root)
+			if err != nil || parsed.Name != name || seen[remote.GetString("name")] {
+				continue
+			}
+			dependents = append(dependents, remote)
+			pending = append(pending, remote.GetString("name"))
+		}
+	}
+	return dependents, nil
+}
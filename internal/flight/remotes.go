@@ -0,0 +1,161 @@
+package flight
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sync"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// WatchRemotes keeps VFS instances and caches in sync with the rclone_remotes records they
+// were built from. Editing type, config, root or name drops the remote's VFS and purges its
+// caches (they may come from a different place now), along with those of the remotes
+// scoped into it; editing vfs_settings or disabling the remote only drops the VFS.
+// Deleting a remote does both. Nothing is purged until the change is committed. Records
+// with a type, config, root or vfs_settings rclone can't use are refused on that field.
+func WatchRemotes(app core.App) {
+	app.OnRecordValidate("rclone_remotes").BindFunc(func(e *core.RecordEvent) error {
+		resolved, err := ResolveRemote(e.App, e.Record)
+		if err == nil {
+			_, err = recordSource(resolved)
+		}
+		if err != nil {
+			field := remoteErrorField(err)
+			return validation.Errors{
+				field: validation.NewError("validation_invalid_"+field, "Invalid "+field+": "+err.Error()),
+			}
+		}
+		if _, err := vfsOptions(e.Record); err != nil {
+			return validation.Errors{
+				"vfs_settings": validation.NewError("validation_invalid_vfs_settings", "Invalid VFS settings: "+err.Error()),
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("rclone_remotes").BindFunc(func(e *core.RecordEvent) error {
+		// Original() is only set when a record is loaded; track the saved state for later edits
+		trackSavedRemote(e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("rclone_remotes").BindFunc(func(e *core.RecordEvent) error {
+		remoteUpdated(e.App, e.Record.Original(), e.Record)
+		trackSavedRemote(e.Record)
+		return e.Next()
+	})
+
+	// The delete clears cache_entries' relation to the remote, so its caches are collected
+	// before and purged once the delete is committed
+	var mu sync.Mutex
+	deleted := map[string][]*core.Record{}
+	app.OnRecordDelete("rclone_remotes").BindFunc(func(e *core.RecordEvent) error {
+		entries, err := e.App.FindRecordsByFilter("cache_entries", "rclone_remote = {:remote}", "", 0, 0,
+			map[string]any{"remote": e.Record.Id})
+		if err != nil {
+			log.Printf("[RCLONE] Warning: failed to list caches of remote %s: %v", e.Record.GetString("name"), err)
+		}
+		mu.Lock()
+		deleted[e.Record.Id] = entries
+		mu.Unlock()
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteError("rclone_remotes").BindFunc(func(e *core.RecordErrorEvent) error {
+		mu.Lock()
+		delete(deleted, e.Record.Id)
+		mu.Unlock()
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("rclone_remotes").BindFunc(func(e *core.RecordEvent) error {
+		mu.Lock()
+		entries := deleted[e.Record.Id]
+		delete(deleted, e.Record.Id)
+		mu.Unlock()
+
+		if rm := GetRcloneManager(); rm != nil {
+			rm.DropRemoteVFS(e.Record.Id)
+		}
+		result := &CachePurgeResult{}
+		for _, entry := range entries {
+			result.add(purgeCacheFile(e.App, entry.GetString("cache_key"), entry.GetString("cache_path")))
+		}
+		log.Printf("[RCLONE] Remote %s deleted, purged %d cache files", e.Record.GetString("name"), result.Files)
+		purgeDependentRemotes(e.App, e.Record.GetString("name"))
+		return e.Next()
+	})
+}
+
+// trackSavedRemote makes the saved state of a remote record its Original(), which the
+// next edit of the same record is compared against
+func trackSavedRemote(record *core.Record) {
+	if err := record.PostScan(); err != nil {
+		log.Printf("[RCLONE] Warning: failed to track saved state of remote %s, its next edit may purge too little: %v",
+			record.GetString("name"), err)
+	}
+}
+
+// remoteUpdated drops the VFS and, when the source changed, the caches of an edited remote
+func remoteUpdated(app core.App, original, record *core.Record) {
+	sourceChanged := record.GetString("name") != original.GetString("name") ||
+		record.GetString("type") != original.GetString("type") ||
+		record.GetString("root") != original.GetString("root") ||
+		!sameJSONField(record, original, "config")
+	settingsChanged := record.GetBool("enabled") != original.GetBool("enabled") ||
+		!sameJSONField(record, original, "vfs_settings")
+	if !sourceChanged && !settingsChanged {
+		// e.g. description or cache_ttl
+		return
+	}
+
+	if rm := GetRcloneManager(); rm != nil {
+		rm.DropRemoteVFS(record.Id)
+	}
+	if !sourceChanged {
+		return
+	}
+
+	if result, err := purgeRemoteCaches(app, record.Id); err != nil {
+		log.Printf("[RCLONE] Warning: failed to purge caches of remote %s: %v", record.GetString("name"), err)
+	} else {
+		log.Printf("[RCLONE] Remote %s reconfigured, purged %d cache files", record.GetString("name"), result.Files)
+	}
+	purgeDependentRemotes(app, original.GetString("name"), record.GetString("name"))
+}
+
+// purgeDependentRemotes drops the VFS and caches of the remotes scoped into the named ones
+// ("r2:analytics/public"), which read through them
+func purgeDependentRemotes(app core.App, names ...string) {
+	dependents, err := dependentRemotes(app, names...)
+	if err != nil {
+		log.Printf("[RCLONE] Warning: failed to list remotes scoped into %v: %v", names, err)
+		return
+	}
+	for _, dependent := range dependents {
+		if rm := GetRcloneManager(); rm != nil {
+			rm.DropRemoteVFS(dependent.Id)
+		}
+		result, err := purgeRemoteCaches(app, dependent.Id)
+		if err != nil {
+			log.Printf("[RCLONE] Warning: failed to purge caches of remote %s: %v", dependent.GetString("name"), err)
+			continue
+		}
+		log.Printf("[RCLONE] Remote %s reads through %v, purged %d cache files", dependent.GetString("name"), names, result.Files)
+	}
+}
+
+// sameJSONField compares a JSON field of two records by value, ignoring formatting and key order
+func sameJSONField(a, b *core.Record, field string) bool {
+	ma, errA := jsonFieldMap(a.Get(field))
+	mb, errB := jsonFieldMap(b.Get(field))
+	if errA != nil || errB != nil {
+		return false
+	}
+	ja, _ := json.Marshal(ma)
+	jb, _ := json.Marshal(mb)
+	return bytes.Equal(ja, jb)
+}
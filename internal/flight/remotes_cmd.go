@@ -0,0 +1,115 @@
+package flight
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/spf13/cobra"
+)
+
+// NewRemotesCommand creates the `remotes` command with the import and export subcommands,
+// which move remotes between rclone.conf files and rclone_remotes. They work on pb_data
+// directly, so the server does not need to be running.
+func NewRemotesCommand(app core.App) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "remotes",
+		Short: "Import and export rclone remotes as rclone.conf",
+	}
+
+	// The server's OnServe hook is not run for commands; validate and purge like it does
+	ensure := func(cmd *cobra.Command, args []string) error {
+		if err := EnsureCollections(app); err != nil {
+			return err
+		}
+		WatchRemotes(app)
+		return nil
+	}
+
+	var opts RemoteImport
+	importCmd := &cobra.Command{
+		Use:   "import [rclone.conf]",
+		Short: "Create or update rclone_remotes from an rclone config file",
+		Long: `Create or update rclone_remotes from an rclone config file, rclone's own config by default.
+Remotes that exist with a different config are only overwritten with --update.`,
+		Example: `  flight remotes import ~/.config/rclone/rclone.conf
+  flight remotes import --dry-run
+  flight remotes import --update team.conf`,
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: ensure,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := config.GetConfigPath()
+			if len(args) == 1 {
+				path = args[0]
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to open rclone config: %w", err)
+			}
+			defer f.Close()
+
+			result, err := ImportRemotes(app, f, opts)
+			if err != nil {
+				return err
+			}
+
+			created, updated := "Created", "Updated"
+			if opts.DryRun {
+				created, updated = "Would create", "Would update"
+			}
+			printNames(created, result.Created)
+			printNames(updated, result.Updated)
+			printNames("Unchanged", result.Unchanged)
+			printNames("Conflicts (use --update to overwrite)", result.Conflicts)
+			for _, name := range sortedKeys(result.Duplicates) {
+				fmt.Printf("Skipped %s: same config as remote %s\n", name, result.Duplicates[name])
+			}
+			for _, name := range sortedKeys(result.Errors) {
+				fmt.Printf("Failed %s: %s\n", name, result.Errors[name])
+			}
+			return nil
+		},
+	}
+	importCmd.Flags().BoolVar(&opts.Update, "update", false, "overwrite remotes of the same name whose config differs")
+	importCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "only report what would change")
+
+	var names []string
+	exportCmd := &cobra.Command{
+		Use:   "export [rclone.conf]",
+		Short: "Write rclone_remotes as an rclone config file, to stdout by default",
+		Example: `  flight remotes export > flight.conf && rclone --config flight.conf lsd r2:
+  flight remotes export --name r2 --name gs team.conf`,
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: ensure,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var w io.Writer = os.Stdout
+			if len(args) == 1 {
+				// The config holds credentials
+				f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					return fmt.Errorf("failed to create rclone config: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+			return ExportRemotes(app, names, w)
+		},
+	}
+	exportCmd.Flags().StringArrayVar(&names, "name", nil, "only export this remote (repeatable)")
+
+	command.AddCommand(importCmd, exportCmd)
+	return command
+}
+
+// printNames prints one line listing the remotes in a result category, if any
+func printNames(label string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Printf("%s (%d): %s\n", label, len(names), strings.Join(names, ", "))
+}
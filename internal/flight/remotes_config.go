@@ -0,0 +1,440 @@
+package flight
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/unknwon/goconfig"
+)
+
+// RemoteImport controls how ImportRemotes treats sections matching existing remotes
+type RemoteImport struct {
+	Update bool `json:"update"`  // overwrite remotes of the same name whose config differs
+	DryRun bool `json:"dry_run"` // report what would change without saving
+}
+
+// RemoteImportResult lists what an import did with each section of an rclone.conf
+type RemoteImportResult struct {
+	Created    []string          `json:"created"`
+	Updated    []string          `json:"updated"`
+	Unchanged  []string          `json:"unchanged"`
+	Conflicts  []string          `json:"conflicts"`  // differ from the remote of the same name, kept without Update
+	Duplicates map[string]string `json:"duplicates"` // section -> existing remote with the same config
+	Errors     map[string]string `json:"errors"`     // section -> why it was not imported
+}
+
+// ErrInvalidRcloneConfig is returned by ImportRemotes for an rclone.conf it can't read
+var ErrInvalidRcloneConfig = errors.New("invalid rclone config")
+
+// ErrRemoteNotFound is returned by ExportRemotes for a name without a remote
+var ErrRemoteNotFound = errors.New("remote not found")
+
+// importedRemote is an rclone.conf section as an rclone_remotes record
+type importedRemote struct {
+	Name   string
+	Type   string
+	Config map[string]string
+	Root   string
+	alias  string // remote of an alias section, resolved once the other sections are known
+}
+
+// ImportRemotes creates or updates rclone_remotes records from an rclone.conf. Every
+// section becomes a remote of the same name; passwords stay obscured as rclone stores
+// them. Alias sections become a root ("remote = r2:analytics" scopes into the r2 remote).
+// Sections with the config of an existing remote under another name are reported as
+// duplicates and skipped.
+func ImportRemotes(app core.App, r io.Reader, opts RemoteImport) (*RemoteImportResult, error) {
+	remotes, err := parseRcloneConfig(r)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := app.FindAllRecords("rclone_remotes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
+	}
+	byName := map[string]*core.Record{}
+	byFingerprint := map[string]string{}
+	for _, record := range existing {
+		byName[record.GetString("name")] = record
+		byFingerprint[recordFingerprint(record)] = record.GetString("name")
+	}
+
+	result := &RemoteImportResult{Duplicates: map[string]string{}, Errors: map[string]string{}}
+	sections := map[string]*importedRemote{}
+	for _, remote := range remotes {
+		sections[remote.Name] = remote
+	}
+
+	// Aliases last, so the remotes they scope into are saved first
+	sort.SliceStable(remotes, func(i, j int) bool {
+		return remotes[i].alias == "" && remotes[j].alias != ""
+	})
+	for _, remote := range remotes {
+		if remote.alias != "" {
+			if err := resolveAlias(remote, sections, byName); err != nil {
+				result.Errors[remote.Name] = err.Error()
+				continue
+			}
+		}
+		if remote.Type == "" {
+			result.Errors[remote.Name] = "section has no type"
+			continue
+		}
+		obscurePasswords(remote.Type, remote.Config)
+
+		fingerprint := remoteFingerprint(remote.Type, remote.Root, remote.Config)
+		record, found := byName[remote.Name]
+		switch {
+		case !found && byFingerprint[fingerprint] != "":
+			result.Duplicates[remote.Name] = byFingerprint[fingerprint]
+			continue
+		case found:
+			if recordFingerprint(record) == fingerprint {
+				result.Unchanged = append(result.Unchanged, remote.Name)
+				continue
+			}
+			if !opts.Update {
+				result.Conflicts = append(result.Conflicts, remote.Name)
+				continue
+			}
+		default:
+			collection, err := app.FindCollectionByNameOrId("rclone_remotes")
+			if err != nil {
+				return nil, fmt.Errorf("failed to find rclone_remotes: %w", err)
+			}
+			record = core.NewRecord(collection)
+			record.Set("name", remote.Name)
+			record.Set("enabled", true)
+		}
+
+		if !opts.DryRun {
+			record.Set("type", remote.Type)
+			record.Set("config", remote.Config)
+			record.Set("root", remote.Root)
+			if err := app.Save(record); err != nil {
+				result.Errors[remote.Name] = err.Error()
+				continue
+			}
+			byName[remote.Name] = record
+		}
+		byFingerprint[fingerprint] = remote.Name
+		if found {
+			result.Updated = append(result.Updated, remote.Name)
+		} else {
+			result.Created = append(result.Created, remote.Name)
+		}
+	}
+
+	log.Printf("[RCLONE] Imported rclone.conf: %d created, %d updated, %d unchanged, %d conflicts, %d duplicates, %d errors",
+		len(result.Created), len(result.Updated), len(result.Unchanged), len(result.Conflicts), len(result.Duplicates), len(result.Errors))
+	return result, nil
+}
+
+// parseRcloneConfig reads the sections of an rclone.conf, in file order
+func parseRcloneConfig(r io.Reader) ([]*importedRemote, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rclone config: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("RCLONE_ENCRYPT_V0:")) {
+		return nil, fmt.Errorf("%w: encrypted config is not supported, export it with `rclone config show` first", ErrInvalidRcloneConfig)
+	}
+
+	gc, err := goconfig.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRcloneConfig, err)
+	}
+
+	var remotes []*importedRemote
+	for _, name := range gc.GetSectionList() {
+		if name == goconfig.DEFAULT_SECTION {
+			continue
+		}
+		remote := &importedRemote{Name: name, Config: map[string]string{}}
+		for _, key := range gc.GetKeyList(name) {
+			value, _ := gc.GetValue(name, key)
+			switch key {
+			case "type":
+				remote.Type = value
+			default:
+				remote.Config[key] = value
+			}
+		}
+		if remote.Type == "alias" {
+			remote.Type = ""
+			remote.alias = remote.Config["remote"]
+			remote.Config = map[string]string{}
+			if remote.alias == "" {
+				return nil, fmt.Errorf("%w: alias remote %q has no remote", ErrInvalidRcloneConfig, name)
+			}
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes, nil
+}
+
+// resolveAlias turns an alias section into a root, taking the type from the remote it
+// names (in the same file or already imported)
+func resolveAlias(remote *importedRemote, sections map[string]*importedRemote, existing map[string]*core.Record) error {
+	parsed, err := fspath.Parse(remote.alias)
+	if err != nil {
+		return fmt.Errorf("invalid alias remote %q: %w", remote.alias, err)
+	}
+	remote.Root = remote.alias
+
+	switch {
+	case parsed.Name == "":
+		remote.Type = "local"
+		remote.Root = parsed.Path
+	case strings.HasPrefix(parsed.Name, ":"):
+		remote.Type = parsed.Name[1:]
+	default:
+		// Follow aliases of aliases to the backend
+		seen := map[string]bool{remote.Name: true}
+		for name := parsed.Name; remote.Type == ""; {
+			if seen[name] {
+				return fmt.Errorf("alias %q loops", remote.alias)
+			}
+			seen[name] = true
+
+			section, inFile := sections[name]
+			record, saved := existing[name]
+			switch {
+			case inFile && section.alias == "":
+				if section.Type == "" {
+					return fmt.Errorf("alias %q names remote %q that has no type", remote.alias, name)
+				}
+				remote.Type = section.Type
+			case inFile:
+				p, err := fspath.Parse(section.alias)
+				if err != nil {
+					return fmt.Errorf("alias %q names remote %q that can't be imported", remote.alias, name)
+				}
+				switch {
+				case p.Name == "":
+					remote.Type = "local"
+				case strings.HasPrefix(p.Name, ":"):
+					remote.Type = p.Name[1:]
+				default:
+					name = p.Name
+				}
+			case saved:
+				remote.Type = record.GetString("type")
+			default:
+				return fmt.Errorf("alias %q names unknown remote %q", remote.alias, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ExportRemotes writes rclone_remotes records as an rclone.conf for the rclone CLI, all
+// remotes or only the named ones. A remote with a root is written as an alias section.
+func ExportRemotes(app core.App, names []string, w io.Writer) error {
+	records, err := app.FindAllRecords("rclone_remotes")
+	if err != nil {
+		return fmt.Errorf("failed to list remotes: %w", err)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].GetString("name") < records[j].GetString("name")
+	})
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	gc, _ := goconfig.LoadFromData(nil)
+	exported := 0
+	for _, record := range records {
+		name := record.GetString("name")
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		config, err := jsonFieldMap(record.Get("config"))
+		if err != nil {
+			return fmt.Errorf("remote %s: %w", name, err)
+		}
+		root, config := remoteRoot(record, config)
+		options := stringConfig(config)
+		obscurePasswords(record.GetString("type"), options)
+
+		if root == "" {
+			gc.SetValue(name, "type", record.GetString("type"))
+			for _, key := range sortedKeys(options) {
+				gc.SetValue(name, key, options[key])
+			}
+		} else {
+			remote, err := aliasRemote(record.GetString("type"), root, options)
+			if err != nil {
+				return fmt.Errorf("remote %s: %w", name, err)
+			}
+			gc.SetValue(name, "type", "alias")
+			gc.SetValue(name, "remote", remote)
+		}
+		exported++
+	}
+	for name := range wanted {
+		if gc.GetKeyList(name) == nil {
+			return fmt.Errorf("%w: %q", ErrRemoteNotFound, name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := goconfig.SaveConfigData(gc, bw); err != nil {
+		return fmt.Errorf("failed to write rclone config: %w", err)
+	}
+	log.Printf("[RCLONE] Exported %d remotes as rclone.conf", exported)
+	return bw.Flush()
+}
+
+// aliasRemote returns the connection string of an alias section for a remote with a root.
+// The remote's config goes in as on-the-fly options, under those of the root.
+func aliasRemote(remoteType, root string, options map[string]string) (string, error) {
+	parsed, err := fspath.Parse(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %q: %w", root, err)
+	}
+	for k, v := range parsed.Config {
+		options[k] = v
+	}
+
+	name := parsed.Name
+	if name == "" {
+		if remoteType == "local" && len(options) == 0 {
+			return parsed.Path, nil
+		}
+		name = ":" + remoteType
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, key := range sortedKeys(options) {
+		value := options[key]
+		if strings.ContainsAny(value, `,:"'`) {
+			value = `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+		}
+		sb.WriteString("," + key + "=" + value)
+	}
+	sb.WriteString(":" + parsed.Path)
+	return sb.String(), nil
+}
+
+// obscurePasswords obscures the password options of a known backend that hold plain text,
+// as rclone expects them obscured in its config. Values that are already obscured, and
+// every value of backends not compiled in, are left alone.
+func obscurePasswords(remoteType string, config map[string]string) {
+	fsInfo, err := fs.Find(remoteType)
+	if err != nil {
+		return
+	}
+	for _, option := range fsInfo.Options {
+		value := config[option.Name]
+		if !option.IsPassword || value == "" {
+			continue
+		}
+		if _, err := obscure.Reveal(value); err == nil {
+			continue
+		}
+		if obscured, err := obscure.Obscure(value); err == nil {
+			config[option.Name] = obscured
+		}
+	}
+}
+
+// stringConfig returns a config JSON map with every value as rclone reads it
+func stringConfig(config map[string]interface{}) map[string]string {
+	options := make(map[string]string, len(config))
+	for k, v := range config {
+		options[k] = fmt.Sprintf("%v", v)
+	}
+	return options
+}
+
+// remoteFingerprint identifies a remote's source for duplicate detection. Passwords are
+// compared revealed: obscuring the same password twice gives different strings.
+func remoteFingerprint(remoteType, root string, config map[string]string) string {
+	revealed := make(map[string]string, len(config))
+	for k, v := range config {
+		revealed[k] = v
+	}
+	if fsInfo, err := fs.Find(remoteType); err == nil {
+		for _, option := range fsInfo.Options {
+			if value, err := obscure.Reveal(revealed[option.Name]); option.IsPassword && err == nil {
+				revealed[option.Name] = value
+			}
+		}
+	}
+	data, _ := json.Marshal([]interface{}{remoteType, root, revealed})
+	return string(data)
+}
+
+// recordFingerprint is the remoteFingerprint of an rclone_remotes record
+func recordFingerprint(record *core.Record) string {
+	config, _ := jsonFieldMap(record.Get("config"))
+	root, config := remoteRoot(record, config)
+	return remoteFingerprint(record.GetString("type"), root, stringConfig(config))
+}
+
+// sortedKeys returns the keys of a config in order
+func sortedKeys(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RegisterRemoteRoutes adds the superuser-only rclone.conf API:
+//
+//	POST /api/flight/remotes/import  import {"config": "<rclone.conf>", "update", "dry_run"}
+//	GET  /api/flight/remotes/export  all remotes as rclone.conf, ?name= selects some
+func RegisterRemoteRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/flight/remotes")
+	g.Bind(apis.RequireSuperuserAuth())
+
+	g.POST("/import", func(e *core.RequestEvent) error {
+		var body struct {
+			RemoteImport
+			Config string `json:"config"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return apis.NewBadRequestError("Invalid import request", err)
+		}
+		result, err := ImportRemotes(e.App, strings.NewReader(body.Config), body.RemoteImport)
+		if errors.Is(err, ErrInvalidRcloneConfig) {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return apis.NewApiError(http.StatusInternalServerError, "Failed to import remotes", err)
+		}
+		return e.JSON(http.StatusOK, result)
+	})
+
+	g.GET("/export", func(e *core.RequestEvent) error {
+		var buf bytes.Buffer
+		err := ExportRemotes(e.App, e.Request.URL.Query()["name"], &buf)
+		if errors.Is(err, ErrRemoteNotFound) {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return apis.NewApiError(http.StatusInternalServerError, "Failed to export remotes", err)
+		}
+		e.Response.Header().Set("Content-Disposition", `attachment; filename="rclone.conf"`)
+		return e.Blob(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+	})
+}
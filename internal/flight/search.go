@@ -0,0 +1,280 @@
+package flight
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// searchIndexSuffix names the FTS5 table that indexes a table: tb0 is searched through tb0_fts
+const searchIndexSuffix = "_fts"
+
+// buildSearchIndex creates an FTS5 table over the TEXT columns of every table in the database
+// at dbPath (the fts arg of a mksqlite_config). The index uses the table as external content,
+// so it stores no second copy of the text; it is built with the rest of the database on
+// every conversion and therefore never outlives a cache rebuild.
+func buildSearchIndex(dbPath string) error {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open output database: %w", err)
+	}
+	defer db.Close()
+
+	tables, err := dataTables(db)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, table := range tables {
+		index := table + searchIndexSuffix
+		// SQLite sources may bring tables the index can't use or a name it would take
+		var taken int
+		db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", index).Scan(&taken)
+		if taken > 0 {
+			log.Printf("[CONVERTER] Not indexing %s, %s already exists", table, index)
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("SELECT rowid FROM %s LIMIT 0", quoteIdent(table))); err != nil {
+			log.Printf("[CONVERTER] Not indexing %s, it has no rowid", table)
+			continue
+		}
+
+		columns, err := textColumns(db, table)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = quoteIdent(column)
+		}
+		create := fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content=%s, content_rowid='rowid')",
+			quoteIdent(index), strings.Join(quoted, ", "), quoteLiteral(table))
+		if _, err := db.Exec(create); err != nil {
+			return fmt.Errorf("failed to create search index for %s: %w", table, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO %[1]s(%[1]s) VALUES ('rebuild')", quoteIdent(index))); err != nil {
+			return fmt.Errorf("failed to build search index for %s: %w", table, err)
+		}
+		log.Printf("[CONVERTER] Built search index %s over %s", index, strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+// DataTables returns the tables of the database at dbPath that hold data, see dataTables
+func DataTables(dbPath string) ([]string, error) {
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	return dataTables(db)
+}
+
+// dataTables returns the tables of db that hold data, by name. Search indexes (virtual tables)
+// and the shadow tables FTS5 keeps them in (tb0_fts_data, _idx, _docsize, _config) are left
+// out, so they are neither indexed, retyped nor taken for the dataset's table.
+func dataTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// textColumns returns the columns of a table declared TEXT (or without a type)
+func textColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		if typ = strings.ToUpper(typ); typ == "TEXT" || typ == "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns, rows.Err()
+}
+
+// ErrNoSearchIndex is returned by SearchWhere for datasets converted without the fts arg
+var ErrNoSearchIndex = errors.New("dataset has no search index")
+
+// SearchWhere returns the WHERE clause matching the rows of table whose text columns contain
+// every word of term, using the table's FTS5 index in the database at dbPath. With table
+// empty, the only data table (or tb0) is searched. Words match as tokens; a trailing "*"
+// matches prefixes.
+func SearchWhere(dbPath, table, term string) (string, error) {
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE 'CREATE VIRTUAL TABLE%fts5%' AND name LIKE ?",
+		"%"+searchIndexSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to list search indexes: %w", err)
+	}
+	indexes := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return "", err
+		}
+		indexes[name] = true
+	}
+	rows.Close()
+
+	if table == "" {
+		table = "tb0"
+		if tables, err := dataTables(db); err == nil && len(tables) == 1 {
+			table = tables[0]
+		}
+	}
+	index := table + searchIndexSuffix
+	if !indexes[index] {
+		return "", ErrNoSearchIndex
+	}
+
+	match := searchMatch(term)
+	if match == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("rowid IN (SELECT rowid FROM %[1]s WHERE %[1]s MATCH %[2]s)", quoteIdent(index), quoteLiteral(match)), nil
+}
+
+// searchMatch turns free text into an FTS5 query: every word quoted as a string, so
+// punctuation and FTS5 keywords are searched for literally, keeping a trailing "*" prefix
+func searchMatch(term string) string {
+	var words []string
+	for _, word := range strings.Fields(term) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+		word = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			word += "*"
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// applySearch rewrites ?q= of a request for the database at cachePath into a where= FTS match
+// for SQLiter, combined with any where= already present. Requests without q are untouched.
+func applySearch(e *core.RequestEvent, b *banquet.Banquet, cachePath string) error {
+	term := e.Request.URL.Query().Get("q")
+	if strings.TrimSpace(term) == "" {
+		return nil
+	}
+
+	where, err := SearchWhere(cachePath, b.Table, term)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	for _, param := range strings.Split(e.Request.URL.RawQuery, "&") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "", "q":
+			continue
+		case "where":
+			if decoded, err := url.QueryUnescape(value); err == nil {
+				value = decoded
+			}
+			if value != "" && where != "" {
+				where = "(" + value + ") AND " + where
+			} else if value != "" {
+				where = value
+			}
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if where != "" {
+		kept = append(kept, "where="+url.QueryEscape(where))
+	}
+
+	// SQLiter parses the request URI like HandleBanquet does; keep its path as sent
+	e.Request.URL.RawQuery = strings.Join(kept, "&")
+	path, _, _ := strings.Cut(e.Request.RequestURI, "?")
+	e.Request.RequestURI = path
+	if e.Request.URL.RawQuery != "" {
+		e.Request.RequestURI += "?" + e.Request.URL.RawQuery
+	}
+	log.Printf("[BANQUET] Search %q: where %s", term, where)
+	return nil
+}
+
+// applyDefaultTable points a request that names no table at the only data table of a database
+// with a search index. SQLiter would otherwise list the tables, the index's among them.
+func applyDefaultTable(e *core.RequestEvent, b *banquet.Banquet, cachePath string) error {
+	if b.Table != "" || b.ColumnPath != "" {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite", "file:"+cachePath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var indexes int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_list WHERE schema = 'main' AND type = 'virtual'").Scan(&indexes); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	if indexes == 0 {
+		return nil
+	}
+	tables, err := dataTables(db)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	if len(tables) != 1 {
+		return nil
+	}
+
+	// SQLiter parses the request URI like HandleBanquet does
+	b.Table = tables[0]
+	path, query, hasQuery := strings.Cut(e.Request.RequestURI, "?")
+	e.Request.RequestURI = strings.TrimSuffix(path, "/") + "/" + url.PathEscape(b.Table)
+	if hasQuery {
+		e.Request.RequestURI += "?" + query
+	}
+	return nil
+}
+
+// quoteLiteral quotes a string literal for SQLite
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
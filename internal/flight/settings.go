@@ -0,0 +1,16 @@
+package flight
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// GetAppSetting returns the value of an app_settings record by key.
+// Settings are looked up on every call so edits in the admin UI apply without a restart.
+// Returns "" when the key is not set.
+func GetAppSetting(app core.App, key string) string {
+	record, err := app.FindFirstRecordByData("app_settings", "key", key)
+	if err != nil || record == nil {
+		return ""
+	}
+	return record.GetString("value")
+}
@@ -0,0 +1,311 @@
+package flight
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darianmavgo/mksqlite/converters/common"
+)
+
+// columnTyper is implemented by row providers that know their column types (Parquet and
+// Arrow schemas). mksqlite's ImportToSQLite creates every column as TEXT, so these are
+// imported by importTyped instead.
+type columnTyper interface {
+	GetColumnTypes(tableName string) []string
+}
+
+// streamImporter is implemented by row providers whose tables and columns are only known
+// once the whole source is read (NDJSON's union schema). They write the database themselves
+// while reading instead of listing headers up front.
+type streamImporter interface {
+	ImportTo(db *sql.DB) error
+}
+
+// argsApplier is implemented by Flight's own row providers that take mksqlite_config args
+// beyond what common.ConversionConfig carries
+type argsApplier interface {
+	applyArgs(opts *ConvertOptions)
+}
+
+// importTyped writes the tables of provider into a new SQLite database at dbPath with the
+// column types reported by typer. Rows are inserted in one transaction per table.
+func importTyped(provider common.RowProvider, typer columnTyper, dbPath string) error {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open output database: %w", err)
+	}
+	defer db.Close()
+
+	for _, table := range provider.GetTableNames() {
+		headers := provider.GetHeaders(table)
+		types := typer.GetColumnTypes(table)
+
+		columns := make([]string, len(headers))
+		for i, name := range headers {
+			columns[i] = quoteIdent(name) + " " + types[i]
+		}
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(table), strings.Join(columns, ", "))); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", table, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(headers)), ", ")
+		stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdent(table), placeholders))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to prepare insert into %s: %w", table, err)
+		}
+
+		rows := 0
+		err = provider.ScanRows(table, func(row []interface{}, rowErr error) error {
+			if rowErr != nil {
+				return rowErr
+			}
+			rows++
+			_, err := stmt.Exec(row...)
+			return err
+		})
+		stmt.Close()
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to import %s: %w", table, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit %s: %w", table, err)
+		}
+		log.Printf("[CONVERTER] Imported %d rows into %s (%s)", rows, table, strings.Join(types, ", "))
+	}
+	return nil
+}
+
+// listingTableSQL creates the tb0 table of a directory listing (IndexDirectory, folders inside
+// archives). Sizes and the directory flag are integers and modification times RFC 3339
+// text with DATETIME affinity, so they sort and filter as numbers and dates.
+const listingTableSQL = `CREATE TABLE tb0 (
+	path TEXT,
+	name TEXT,
+	size INTEGER,
+	extension TEXT,
+	mod_time DATETIME,
+	is_dir INTEGER
+)`
+
+// listingColumnTypes are the typed columns of directory listings, including the extra ones
+// of mksqlite's filesystem converter
+var listingColumnTypes = map[string]string{
+	"size":        "INTEGER",
+	"mod_time":    "DATETIME",
+	"create_time": "DATETIME",
+	"is_dir":      "INTEGER",
+}
+
+// listingProvider types the columns of mksqlite's filesystem converter, which yields sizes
+// and the directory flag as integers but would import them as TEXT
+type listingProvider struct {
+	common.RowProvider
+}
+
+// GetColumnTypes implements columnTyper
+func (p listingProvider) GetColumnTypes(tableName string) []string {
+	headers := p.GetHeaders(tableName)
+	types := make([]string, len(headers))
+	for i, name := range headers {
+		if typ, ok := listingColumnTypes[name]; ok {
+			types[i] = typ
+		} else {
+			types[i] = "TEXT"
+		}
+	}
+	return types
+}
+
+// inferLayouts are the date and time formats a TEXT column may hold to become DATETIME
+var inferLayouts = []string{time.RFC3339Nano, time.DateTime, time.DateOnly, "2006-01-02T15:04:05"}
+
+// inferColumnTypes rewrites the TEXT columns of every table in the database at dbPath whose
+// first sample non-empty values all parse as integers, numbers or dates into INTEGER, REAL
+// or DATETIME columns. SQLite only converts values that fit the new affinity, so rows past
+// the sample that do not parse keep their text; empty strings in retyped columns become NULL.
+func inferColumnTypes(dbPath string, sample int) error {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open output database: %w", err)
+	}
+	defer db.Close()
+
+	tables, err := dataTables(db)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, table := range tables {
+		if err := inferTableTypes(db, table, sample); err != nil {
+			return fmt.Errorf("failed to infer column types of %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// inferTableTypes retypes the columns of one table, rebuilding it when any column changes
+func inferTableTypes(db *sql.DB, table string, sample int) error {
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	var names, types []string
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+		types = append(types, strings.ToUpper(typ))
+	}
+	rows.Close()
+
+	changed := false
+	for i, name := range names {
+		if types[i] != "TEXT" && types[i] != "" {
+			continue
+		}
+		values, err := sampleColumn(db, table, name, sample)
+		if err != nil {
+			return err
+		}
+		if typ := inferredType(values); typ != "TEXT" {
+			types[i] = typ
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	columns := make([]string, len(names))
+	selects := make([]string, len(names))
+	for i, name := range names {
+		if types[i] == "" {
+			types[i] = "TEXT"
+		}
+		columns[i] = quoteIdent(name) + " " + types[i]
+		selects[i] = quoteIdent(name)
+		if types[i] != "TEXT" {
+			selects[i] = fmt.Sprintf("NULLIF(%s, '')", quoteIdent(name))
+		}
+	}
+
+	// SQLite cannot change a column's type: copy into a typed table and swap it in
+	typed := table + "__typed"
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(typed), strings.Join(columns, ", ")),
+		fmt.Sprintf("INSERT INTO %s SELECT %s FROM %s", quoteIdent(typed), strings.Join(selects, ", "), quoteIdent(table)),
+		fmt.Sprintf("DROP TABLE %s", quoteIdent(table)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(typed), quoteIdent(table)),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[CONVERTER] Inferred column types of %s (%s)", table, strings.Join(types, ", "))
+	return nil
+}
+
+// sampleColumn returns up to sample non-empty values of a column as text
+func sampleColumn(db *sql.DB, table, column string, sample int) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT CAST(%[1]s AS TEXT) FROM %[2]s WHERE %[1]s IS NOT NULL AND %[1]s != '' LIMIT ?",
+		quoteIdent(column), quoteIdent(table)), sample)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// inferredType returns the narrowest of INTEGER, REAL and DATETIME every value parses as,
+// else TEXT (also for no values)
+func inferredType(values []string) string {
+	if len(values) == 0 {
+		return "TEXT"
+	}
+	integers, numbers, dates := true, true, true
+	for _, v := range values {
+		if integers && !isInteger(v) {
+			integers = false
+		}
+		if numbers {
+			f, err := strconv.ParseFloat(v, 64)
+			numbers = err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) && !hasLeadingZero(v)
+		}
+		if dates {
+			dates = isDateTime(v)
+		}
+		if !integers && !numbers && !dates {
+			return "TEXT"
+		}
+	}
+	switch {
+	case integers:
+		return "INTEGER"
+	case numbers:
+		return "REAL"
+	case dates:
+		return "DATETIME"
+	}
+	return "TEXT"
+}
+
+// isInteger reports whether v is a plain 64-bit integer. Values with leading zeros or a "+"
+// (zip codes, phone numbers, IDs) would lose them as numbers and are not.
+func isInteger(v string) bool {
+	if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+		return false
+	}
+	return v[0] != '+' && !hasLeadingZero(v)
+}
+
+// hasLeadingZero reports a zero padded number such as "007" or "-01.5"
+func hasLeadingZero(v string) bool {
+	digits := strings.TrimPrefix(v, "-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] != '.'
+}
+
+// isDateTime reports whether v is a date or timestamp in one of inferLayouts
+func isDateTime(v string) bool {
+	for _, layout := range inferLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteIdent quotes a table or column name for SQLite
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
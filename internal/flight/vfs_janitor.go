@@ -0,0 +1,72 @@
+package flight
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	rclonefs "github.com/rclone/rclone/fs"
+)
+
+const (
+	// vfsJanitorSchedule is how often idle VFS instances are shut down
+	vfsJanitorSchedule = "* * * * *"
+	// defaultVFSIdleTimeout is how long an unused VFS instance stays live
+	defaultVFSIdleTimeout = 30 * time.Minute
+	// defaultVFSMaxInstances caps the live VFS instances; every ad-hoc HTTP host gets its own
+	defaultVFSMaxInstances = 16
+)
+
+// GetVFSIdleTimeout returns the "vfs_idle_timeout" app setting in rclone duration syntax
+// ("10m", "2h"); 0 keeps instances until shutdown. Defaults to 30 minutes.
+func GetVFSIdleTimeout(app core.App) time.Duration {
+	val := strings.TrimSpace(GetAppSetting(app, "vfs_idle_timeout"))
+	if val == "" {
+		return defaultVFSIdleTimeout
+	}
+
+	timeout, err := rclonefs.ParseDuration(val)
+	if err != nil || timeout < 0 {
+		log.Printf("[RCLONE] Ignoring invalid app_settings vfs_idle_timeout %q: %v", val, err)
+		return defaultVFSIdleTimeout
+	}
+	return timeout
+}
+
+// GetVFSMaxInstances returns the "vfs_max_instances" app setting; 0 means unlimited.
+// Defaults to 16.
+func GetVFSMaxInstances(app core.App) int {
+	val := strings.TrimSpace(GetAppSetting(app, "vfs_max_instances"))
+	if val == "" {
+		return defaultVFSMaxInstances
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		log.Printf("[RCLONE] Ignoring invalid app_settings vfs_max_instances %q", val)
+		return defaultVFSMaxInstances
+	}
+	return n
+}
+
+// applyVFSLimits passes the VFS app settings to the rclone manager
+func applyVFSLimits(app core.App) {
+	if rm := GetRcloneManager(); rm != nil {
+		rm.SetVFSLimits(GetVFSIdleTimeout(app), GetVFSMaxInstances(app))
+	}
+}
+
+// StartVFSJanitor applies the VFS limits and schedules idle eviction
+func StartVFSJanitor(app core.App) {
+	applyVFSLimits(app)
+
+	app.Cron().MustAdd("flight_vfs_janitor", vfsJanitorSchedule, func() {
+		// Settings are re-read so edits apply without a restart
+		applyVFSLimits(app)
+		if rm := GetRcloneManager(); rm != nil {
+			rm.EvictIdleVFS()
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package flight
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// vfsSettingAliases maps the short vfs_settings keys that don't follow the "vfs_" prefix
+// rule to rclone's option names
+var vfsSettingAliases = map[string]string{
+	"chunk_size":       "vfs_read_chunk_size",
+	"chunk_size_limit": "vfs_read_chunk_size_limit",
+	"chunk_streams":    "vfs_read_chunk_streams",
+}
+
+// defaultVFSOptions returns rclone's VFS defaults with Flight's tuning on top
+func defaultVFSOptions() vfscommon.Options {
+	opts := vfscommon.Opt
+	opts.CacheMode = vfscommon.CacheModeFull // Critical for random access
+	opts.DirCacheTime = fs.Duration(10 * time.Minute)
+	opts.CacheMaxAge = fs.Duration(24 * time.Hour)
+	opts.CachePollInterval = fs.Duration(time.Minute)
+	opts.ChunkSize = 128 * fs.Mebi
+	opts.ReadAhead = 0 // Disable read-ahead by default
+	return opts
+}
+
+// vfsOptions returns the VFS options of a remote: the defaults overridden by its vfs_settings.
+// Keys are rclone's VFS option names ("vfs_cache_max_age", "dir_cache_time") or the same
+// without the "vfs_" prefix ("cache_max_age"); "chunk_size", "chunk_size_limit" and
+// "chunk_streams" stand for the vfs_read_* options. Values use rclone's syntax ("10m",
+// "1G", "full"); JSON numbers are seconds for durations and bytes for sizes.
+func vfsOptions(remoteRecord *core.Record) (vfscommon.Options, error) {
+	opts := defaultVFSOptions()
+
+	settings, err := jsonFieldMap(remoteRecord.Get("vfs_settings"))
+	if err != nil {
+		return opts, err
+	}
+	if len(settings) == 0 {
+		return opts, nil
+	}
+
+	items, err := configstruct.Items(&opts)
+	if err != nil {
+		return opts, err
+	}
+	kinds := make(map[string]any, len(items))
+	for _, item := range items {
+		kinds[item.Name] = item.Value
+	}
+
+	// Sorted so the first invalid key reported is stable
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	config := configmap.Simple{}
+	for _, key := range keys {
+		name := strings.ToLower(strings.TrimSpace(key))
+		if alias, ok := vfsSettingAliases[name]; ok {
+			name = alias
+		} else if _, ok := kinds[name]; !ok {
+			name = "vfs_" + name
+		}
+		kind, ok := kinds[name]
+		if !ok {
+			return opts, fmt.Errorf("unknown VFS setting %q", key)
+		}
+		if _, dup := config[name]; dup {
+			return opts, fmt.Errorf("VFS setting %q is set twice", name)
+		}
+		config[name] = vfsSettingString(settings[key], kind)
+	}
+
+	if err := configstruct.Set(config, &opts); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// vfsSettingString formats a JSON value for rclone's option parser
+func vfsSettingString(value any, kind any) string {
+	n, ok := value.(float64)
+	if !ok {
+		return strings.TrimSpace(fmt.Sprint(value))
+	}
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	if _, isSize := kind.(fs.SizeSuffix); isSize {
+		// A bare number is KiB to rclone; JSON numbers have always meant bytes here
+		s += "B"
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestTarArchives verifies the tar listing driver and converting a single entry of a
+// tar.gz bundle addressed by a path that continues past the archive.
+func TestTarArchives(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_tar_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	split := []struct{ path, archive, entry string }{
+		{"bundle.tar.gz/2026/sales.csv", "bundle.tar.gz", "2026/sales.csv"},
+		{"/data/bundle.tgz/notes.txt", "/data/bundle.tgz", "notes.txt"},
+		{"/data/bundle.tar", "/data/bundle.tar", ""},
+		{"/data/bundle.tar.gz/", "/data/bundle.tar.gz/", ""},
+		{"/data/sales.csv", "/data/sales.csv", ""},
+	}
+	for _, tc := range split {
+		archive, entry := flight.SplitArchivePath(tc.path)
+		if archive != tc.archive || entry != tc.entry {
+			t.Errorf("SplitArchivePath(%q) = %q, %q; want %q, %q", tc.path, archive, entry, tc.archive, tc.entry)
+		}
+	}
+
+	// Monthly bundle as the data team ships it
+	serveDir := filepath.Join(tempDir, "data")
+	if err := os.MkdirAll(serveDir, 0755); err != nil {
+		t.Fatalf("Failed to create serve folder: %v", err)
+	}
+	bundlePath := filepath.Join(serveDir, "bundle.tar.gz")
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	members := []struct {
+		name string
+		data string
+	}{
+		{"./2026/", ""},
+		{"./2026/sales.csv", "region,amount\nnorth,10\nsouth,20\neast,30\n"},
+		{"./README.txt", "monthly export\n"},
+	}
+	for _, m := range members {
+		header := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if m.data == "" {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		tw.WriteHeader(header)
+		tw.Write([]byte(m.data))
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	// 1. The archive itself converts to a listing
+	listingDB := filepath.Join(tempDir, "listing.db")
+	result, err := flight.ConvertSource(bundlePath, listingDB, nil)
+	if err != nil {
+		t.Fatalf("Converting the bundle failed: %v", err)
+	}
+	if result.Driver != "tar" {
+		t.Errorf("Expected tar driver, got %s", result.Driver)
+	}
+	if n := countRows(t, listingDB, "SELECT COUNT(*) FROM file_list WHERE is_dir = 'false'"); n != 2 {
+		t.Errorf("Expected 2 files in listing, got %d", n)
+	}
+
+	// 2. An entry converts as its own dataset with its own cache entry
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	settings, _ := app.FindCollectionByNameOrId("app_settings")
+	setting := core.NewRecord(settings)
+	setting.Load(map[string]any{"key": "serve_folder", "value": serveDir})
+	if err := app.Save(setting); err != nil {
+		t.Fatalf("Failed to save serve_folder: %v", err)
+	}
+
+	pipelines, _ := app.FindCollectionByNameOrId("data_pipelines")
+	pipeline := core.NewRecord(pipelines)
+	pipeline.Load(map[string]any{"name": "january", "rclone_path": "bundle.tar.gz/2026/sales.csv"})
+	if err := app.Save(pipeline); err != nil {
+		t.Fatalf("Failed to save pipeline: %v", err)
+	}
+	if err := flight.RunPipeline(app, pipeline); err != nil {
+		t.Fatalf("RunPipeline failed: %v", err)
+	}
+
+	_, cachePath, err := flight.CacheURLLocation(app, "/bundle.tar.gz/2026/sales.csv")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v", err)
+	}
+	if n := countRows(t, cachePath, "SELECT COUNT(*) FROM tb0"); n != 3 {
+		t.Errorf("Expected 3 rows from the extracted entry, got %d", n)
+	}
+	if _, archiveCache, _ := flight.CacheURLLocation(app, "/bundle.tar.gz"); archiveCache == cachePath {
+		t.Error("Expected the entry and the archive to have separate caches")
+	}
+
+	// 3. Missing entries are reported as such
+	pipeline.Set("rclone_path", "bundle.tar.gz/2026/missing.csv")
+	if err := flight.RunPipeline(app, pipeline); !errors.Is(err, flight.ErrArchiveEntryNotFound) {
+		t.Errorf("Expected ErrArchiveEntryNotFound, got %v", err)
+	}
+}
+
+// countRows runs a COUNT query against a SQLite file
+func countRows(t *testing.T, dbPath, query string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("Query %q failed: %v", query, err)
+	}
+	return n
+}
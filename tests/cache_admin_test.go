@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/darianmavgo/sqliter/sqliter"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestPurgeCache verifies purging by URL, by local path prefix and of the whole cache.
+func TestPurgeCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_purge_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	serveDir := filepath.Join(tempDir, "data")
+	settings, _ := app.FindCollectionByNameOrId("app_settings")
+	setting := core.NewRecord(settings)
+	setting.Load(map[string]any{"key": "serve_folder", "value": serveDir})
+	if err := app.Save(setting); err != nil {
+		t.Fatalf("Failed to save serve_folder: %v", err)
+	}
+
+	// Fake cached databases for three local datasets
+	paths := []string{"reports/jan.csv", "reports/feb.csv", "other/mar.csv"}
+	cachePaths := map[string]string{}
+	for _, p := range paths {
+		cacheKey, cachePath, err := flight.CacheURLLocation(app, "/"+p)
+		if err != nil {
+			t.Fatalf("CacheURLLocation(%s): %v", p, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+			t.Fatalf("Failed to create cache dir: %v", err)
+		}
+		if err := os.WriteFile(cachePath, []byte("cached"), 0644); err != nil {
+			t.Fatalf("Failed to write cache: %v", err)
+		}
+		err = flight.RecordCacheBuild(app, flight.CacheEntry{
+			CacheKey:   cacheKey,
+			CachePath:  cachePath,
+			SourcePath: flight.ResolveLocalPath(app, p),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record cache entry: %v", err)
+		}
+		cachePaths[p] = cachePath
+	}
+
+	exists := func(p string) bool {
+		_, err := os.Stat(cachePaths[p])
+		return err == nil
+	}
+
+	stats, err := flight.GetCacheStats(app)
+	if err != nil {
+		t.Fatalf("GetCacheStats: %v", err)
+	}
+	if stats.Entries != 3 || stats.Files != 3 || stats.Bytes != 18 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// 1. Single URL
+	result, err := flight.PurgeCache(app, flight.CachePurge{URL: "/reports/jan.csv"})
+	if err != nil {
+		t.Fatalf("Purge by URL: %v", err)
+	}
+	if result.Files != 1 || exists("reports/jan.csv") || !exists("reports/feb.csv") {
+		t.Errorf("Purge by URL removed the wrong files (%+v)", result)
+	}
+
+	// 2. Local prefix
+	if _, err := flight.PurgeCache(app, flight.CachePurge{Prefix: "reports"}); err != nil {
+		t.Fatalf("Purge by prefix: %v", err)
+	}
+	if exists("reports/feb.csv") || !exists("other/mar.csv") {
+		t.Error("Purge by prefix removed the wrong files")
+	}
+
+	// 3. Everything
+	if _, err := flight.PurgeCache(app, flight.CachePurge{All: true}); err != nil {
+		t.Fatalf("Purge all: %v", err)
+	}
+	if exists("other/mar.csv") {
+		t.Error("Expected purge all to remove every cache file")
+	}
+	if records, _ := flight.ListCacheEntries(app); len(records) != 0 {
+		t.Errorf("Expected no cache entries after purge all, got %d", len(records))
+	}
+
+	// Bad requests are told apart from failures while purging (400 vs 500 in the API)
+	if _, err := flight.PurgeCache(app, flight.CachePurge{}); !errors.Is(err, flight.ErrInvalidPurge) {
+		t.Errorf("Expected ErrInvalidPurge for an empty purge request, got %v", err)
+	}
+}
+
+// TestPurgeCacheRemote verifies purging by remote removes that remote's caches and the
+// archives their entries were extracted from, and nothing of other remotes.
+func TestPurgeCacheRemote(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_purge_remote_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	remoteIDs := map[string]string{}
+	for _, name := range []string{"sales", "hr"} {
+		remote := core.NewRecord(remotes)
+		remote.Load(map[string]any{"name": name, "type": "local", "enabled": true})
+		if err := app.Save(remote); err != nil {
+			t.Fatalf("Failed to save remote %s: %v", name, err)
+		}
+		remoteIDs[name] = remote.Id
+	}
+
+	// Each remote has a member of a downloaded archive cached
+	archiveDir := filepath.Join(pbDataDir, "cache", "archives")
+	os.MkdirAll(archiveDir, 0755)
+	files := map[string]string{}
+	for name, id := range remoteIDs {
+		archiveKey := "v2-" + name + "bundle.zip-0001"
+		files[name+" archive"] = filepath.Join(archiveDir, archiveKey+".zip")
+		files[name+" cache"] = flight.GetCachePath(pbDataDir, "v2-"+name+"bundle.zip_a.csv-0002")
+		os.WriteFile(files[name+" archive"], []byte("archive"), 0644)
+		os.WriteFile(files[name+" archive"]+".source.json", []byte("{}"), 0644)
+		os.WriteFile(files[name+" cache"], []byte("cached"), 0644)
+		err := flight.RecordCacheBuild(app, flight.CacheEntry{
+			CacheKey:   "v2-" + name + "bundle.zip_a.csv-0002",
+			CachePath:  files[name+" cache"],
+			RemoteID:   id,
+			SourcePath: "/bundle.zip/a.csv",
+			ArchiveKey: archiveKey,
+		})
+		if err != nil {
+			t.Fatalf("Failed to record cache entry: %v", err)
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	result, err := flight.PurgeCache(app, flight.CachePurge{Remote: "sales"})
+	if err != nil {
+		t.Fatalf("Purge by remote: %v", err)
+	}
+	if result.Files != 2 {
+		t.Errorf("Expected the cache and its archive to be purged, got %+v", result)
+	}
+	if exists(files["sales cache"]) || exists(files["sales archive"]) || exists(files["sales archive"]+".source.json") {
+		t.Error("Expected the remote's cache and archive to be removed")
+	}
+	if !exists(files["hr cache"]) || !exists(files["hr archive"]) {
+		t.Error("Expected other remotes' caches and archives to be kept")
+	}
+
+	if _, err := flight.PurgeCache(app, flight.CachePurge{Remote: "missing"}); !errors.Is(err, flight.ErrInvalidPurge) {
+		t.Errorf("Expected ErrInvalidPurge for an unknown remote, got %v", err)
+	}
+}
+
+// TestPurgeCacheRemoteURL verifies that a remote dataset cached by a request is purged by
+// its URL in the documented path form (/local:/disk/sales.csv).
+func TestPurgeCacheRemoteURL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_purge_remote_url_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dataDir := filepath.Join(tempDir, "data")
+	os.MkdirAll(dataDir, 0755)
+	if err := os.WriteFile(filepath.Join(dataDir, "sales.csv"), []byte("region,total\nnorth,1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	defer flight.GetRcloneManager().Shutdown()
+	flight.SetSQLiterServer(sqliter.NewServer(sqliter.DefaultConfig()))
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	remote := core.NewRecord(remotes)
+	remote.Load(map[string]any{"name": "disk", "type": "local", "enabled": true, "root": dataDir})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to save remote: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RequestURI = "http://localhost/local:/disk/sales.csv"
+	e := &core.RequestEvent{App: app}
+	e.Request, e.Response = req, httptest.NewRecorder()
+	if err := flight.HandleBanquet(e, false); err != nil {
+		t.Fatalf("HandleBanquet failed: %v", err)
+	}
+	entry, err := app.FindFirstRecordByData("cache_entries", "rclone_remote", remote.Id)
+	if err != nil {
+		t.Fatalf("Expected a cache entry for the request: %v", err)
+	}
+	cachePath := entry.GetString("cache_path")
+
+	for _, url := range []string{"/local:/disk/sales.csv", "local:/disk/sales.csv", "http://localhost/local:/disk/sales.csv"} {
+		cacheKey, _, err := flight.CacheURLLocation(app, url)
+		if err != nil {
+			t.Fatalf("CacheURLLocation(%s): %v", url, err)
+		}
+		if cacheKey != entry.GetString("cache_key") {
+			t.Errorf("CacheURLLocation(%s) = %s, want the key the request wrote (%s)", url, cacheKey, entry.GetString("cache_key"))
+		}
+	}
+
+	result, err := flight.PurgeCache(app, flight.CachePurge{URL: "/local:/disk/sales.csv"})
+	if err != nil {
+		t.Fatalf("Purge by remote URL: %v", err)
+	}
+	if result.Files != 1 {
+		t.Errorf("Expected the remote cache to be purged, got %+v", result)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("Expected the remote cache file to be removed")
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", entry.GetString("cache_key")); err == nil {
+		t.Error("Expected the cache entry to be removed")
+	}
+}
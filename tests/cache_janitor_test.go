@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// TestEvictCache verifies the janitor evicts least recently used databases (with their journals
+// and sidecars) until under quota, skips leased and recently used ones, and does not count the
+// rclone VFS cache against the quota.
+func TestEvictCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_janitor_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	// A VFS cache far over the quota, which the janitor can't evict
+	cacheDir := filepath.Join(pbDataDir, "cache")
+	vfsFile := filepath.Join(cacheDir, "vfs", "disk", "big.csv")
+	os.MkdirAll(filepath.Dir(vfsFile), 0755)
+	os.WriteFile(vfsFile, bytes.Repeat([]byte("x"), 10000), 0644)
+
+	// Four 100 byte databases, last used from oldest to newest
+	now := time.Now()
+	lastAccess := map[string]time.Time{
+		"v2-leased-0001": now.Add(-3 * time.Hour),
+		"v2-oldest-0002": now.Add(-2 * time.Hour),
+		"v2-older-0003":  now.Add(-time.Hour),
+		"v2-recent-0004": now.Add(-time.Minute),
+	}
+	cachePath := func(key string) string {
+		return flight.GetCachePath(pbDataDir, key)
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	for key, last := range lastAccess {
+		os.WriteFile(cachePath(key), bytes.Repeat([]byte("d"), 100), 0644)
+		if err := flight.RecordCacheBuild(app, flight.CacheEntry{CacheKey: key, CachePath: cachePath(key)}); err != nil {
+			t.Fatalf("Failed to record cache entry: %v", err)
+		}
+		record, _ := app.FindFirstRecordByData("cache_entries", "cache_key", key)
+		accessed, _ := types.ParseDateTime(last)
+		record.Set("last_access", accessed)
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to set last access: %v", err)
+		}
+	}
+	os.WriteFile(cachePath("v2-oldest-0002")+"-wal", nil, 0644)
+	os.WriteFile(cachePath("v2-oldest-0002")+".source.json", []byte("{}"), 0644)
+
+	release := flight.AcquireCache(cachePath("v2-leased-0001"))
+	defer release()
+
+	// 1. Under quota once the VFS cache is left out
+	if freed, err := flight.EvictCache(app, 500); err != nil || freed != 0 {
+		t.Errorf("Expected nothing evicted under quota, freed %d (err %v)", freed, err)
+	}
+
+	// 2. The least recently used entry that isn't leased goes first, with its siblings
+	if _, err := flight.EvictCache(app, 350); err != nil {
+		t.Fatalf("EvictCache failed: %v", err)
+	}
+	oldest := cachePath("v2-oldest-0002")
+	if exists(oldest) || exists(oldest+"-wal") || exists(oldest+".source.json") {
+		t.Error("Expected the least recently used database and its siblings to be evicted")
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", "v2-oldest-0002"); err == nil {
+		t.Error("Expected the evicted entry's cache_entries record to be removed")
+	}
+	if !exists(cachePath("v2-older-0003")) {
+		t.Error("Expected eviction to stop once under quota")
+	}
+
+	// 3. Leased entries and entries within the grace period are kept, even over quota
+	if _, err := flight.EvictCache(app, 50); err != nil {
+		t.Fatalf("EvictCache failed: %v", err)
+	}
+	if exists(cachePath("v2-older-0003")) {
+		t.Error("Expected the next least recently used database to be evicted")
+	}
+	if !exists(cachePath("v2-leased-0001")) {
+		t.Error("Expected the leased database to be kept")
+	}
+	if !exists(cachePath("v2-recent-0004")) {
+		t.Error("Expected the database used within the grace period to be kept")
+	}
+	if !exists(vfsFile) {
+		t.Error("Expected the VFS cache to be left alone")
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+)
+
+// TestGenCacheKeyInjective verifies that paths and queries which used to collide get distinct keys.
+func TestGenCacheKeyInjective(t *testing.T) {
+	key := func(rawURL string) string {
+		b, err := banquet.ParseBanquet(rawURL)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", rawURL, err)
+		}
+		return flight.GenCacheKey(b)
+	}
+
+	distinct := [][2]string{
+		{"s3://sales/a/b.csv", "s3://sales/a_b.csv"},
+		{"https://example.com/report.csv?month=1", "https://example.com/report.csv?month=2"},
+		{"s3://sales/report.csv", "s3://marketing/report.csv"},
+	}
+	for _, pair := range distinct {
+		if a, b := key(pair[0]), key(pair[1]); a == b {
+			t.Errorf("Expected distinct keys for %s and %s, both got %s", pair[0], pair[1], a)
+		}
+	}
+
+	// Banquet's own query parameters filter the cached database, they don't change the fetch
+	if a, b := key("s3://sales/report.csv"), key("s3://sales/report.csv?where=amount>10&limit=5"); a != b {
+		t.Errorf("Expected where/limit not to affect the key: %s vs %s", a, b)
+	}
+
+	k := key("s3://sales/reports/2026/report.csv")
+	if !strings.HasPrefix(k, flight.CacheKeyVersion+"-") || !strings.Contains(k, "report.csv") {
+		t.Errorf("Expected versioned, readable key, got %s", k)
+	}
+	if strings.ContainsAny(k, "/\\?&") {
+		t.Errorf("Key must be usable as a file name, got %s", k)
+	}
+
+	if flight.LocalCacheKey("/data/a/b.csv") == flight.LocalCacheKey("/data/a_b.csv") {
+		t.Error("Expected distinct local keys for /data/a/b.csv and /data/a_b.csv")
+	}
+}
+
+// TestMigrateCacheKeys verifies that caches named by the old key scheme are dropped.
+func TestMigrateCacheKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_cachekey_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	cacheDir := filepath.Join(app.DataDir(), "cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+
+	oldPath := filepath.Join(cacheDir, "sales-_reports_today.csv.db")
+	newPath := flight.GetCachePath(app.DataDir(), flight.LocalCacheKey("/data/today.csv"))
+	for _, path := range []string{oldPath, oldPath + ".source.json", newPath} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := flight.RecordCacheBuild(app, flight.CacheEntry{CacheKey: "sales-_reports_today.csv", CachePath: oldPath}); err != nil {
+		t.Fatalf("Failed to record old entry: %v", err)
+	}
+
+	if removed := flight.MigrateCacheKeys(app); removed != 1 {
+		t.Errorf("Expected 1 old cache file removed, got %d", removed)
+	}
+	for _, path := range []string{oldPath, oldPath + ".source.json"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", filepath.Base(path))
+		}
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Expected current-scheme cache to be kept: %v", err)
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", "sales-_reports_today.csv"); err == nil {
+		t.Error("Expected old cache entry to be removed")
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestResolveCacheTTL verifies the pipeline -> remote -> app_settings -> default resolution order.
+func TestResolveCacheTTL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_ttl_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	save := func(collection string, data map[string]any) *core.Record {
+		col, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			t.Fatalf("Failed to find %s: %v", collection, err)
+		}
+		rec := core.NewRecord(col)
+		rec.Load(data)
+		if err := app.Save(rec); err != nil {
+			t.Fatalf("Failed to save %s record: %v", collection, err)
+		}
+		return rec
+	}
+
+	remote := save("rclone_remotes", map[string]any{
+		"name":    "sales",
+		"type":    "local",
+		"enabled": true,
+	})
+
+	// 1. Nothing configured: built-in default
+	if ttl := flight.ResolveCacheTTL(app, remote, "reports/hourly/today.csv"); ttl != flight.DefaultCacheTTL {
+		t.Errorf("Expected default TTL %v, got %v", flight.DefaultCacheTTL, ttl)
+	}
+
+	// 2. Global app setting
+	save("app_settings", map[string]any{"key": "cache_ttl", "value": "720"})
+	if ttl := flight.ResolveCacheTTL(app, remote, "reports/hourly/today.csv"); ttl != 720 {
+		t.Errorf("Expected app_settings TTL 720, got %v", ttl)
+	}
+
+	// 3. Per-remote default
+	remote.Set("cache_ttl", 240)
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to update remote: %v", err)
+	}
+	if ttl := flight.ResolveCacheTTL(app, remote, "reports/hourly/today.csv"); ttl != 240 {
+		t.Errorf("Expected remote TTL 240, got %v", ttl)
+	}
+
+	// A pipeline without a remote covers local datasets, not the remote's
+	save("data_pipelines", map[string]any{
+		"name":        "local exports",
+		"rclone_path": "/exports",
+		"cache_ttl":   30,
+	})
+	if ttl := flight.ResolveCacheTTL(app, nil, "exports/today.csv"); ttl != 30 {
+		t.Errorf("Expected local pipeline TTL 30, got %v", ttl)
+	}
+	if ttl := flight.ResolveCacheTTL(app, remote, "exports/today.csv"); ttl != 240 {
+		t.Errorf("Expected the local pipeline not to apply to a remote, got %v", ttl)
+	}
+
+	// 4. Pipelines: the most specific rclone_path wins
+	save("data_pipelines", map[string]any{
+		"name":          "all reports",
+		"rclone_remote": remote.Id,
+		"rclone_path":   "/reports",
+		"cache_ttl":     525600,
+	})
+	save("data_pipelines", map[string]any{
+		"name":          "hourly sales",
+		"rclone_remote": remote.Id,
+		"rclone_path":   "/reports/hourly",
+		"cache_ttl":     60,
+	})
+
+	cases := map[string]float64{
+		"reports/hourly/today.csv": 60,
+		"/reports/yearly/ref.xlsx": 525600,
+		"reports_other/file.csv":   240, // not a child of /reports
+	}
+	for path, want := range cases {
+		if ttl := flight.ResolveCacheTTL(app, remote, path); ttl != want {
+			t.Errorf("ResolveCacheTTL(%q) = %v, want %v", path, ttl, want)
+		}
+	}
+
+	// Local datasets only match pipelines without a remote
+	if ttl := flight.ResolveCacheTTL(app, nil, "reports/hourly/today.csv"); ttl != 720 {
+		t.Errorf("Expected local dataset to use app_settings TTL 720, got %v", ttl)
+	}
+}
+
+// TestResolveStaleWhileRevalidate verifies the per-pipeline flag and the global app setting.
+func TestResolveStaleWhileRevalidate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_swr_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	save := func(collection string, data map[string]any) *core.Record {
+		col, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			t.Fatalf("Failed to find %s: %v", collection, err)
+		}
+		rec := core.NewRecord(col)
+		rec.Load(data)
+		if err := app.Save(rec); err != nil {
+			t.Fatalf("Failed to save %s record: %v", collection, err)
+		}
+		return rec
+	}
+
+	remote := save("rclone_remotes", map[string]any{
+		"name":    "sales",
+		"type":    "local",
+		"enabled": true,
+	})
+
+	if flight.ResolveStaleWhileRevalidate(app, remote, "reports/today.csv") {
+		t.Error("Expected stale-while-revalidate to be disabled by default")
+	}
+
+	save("data_pipelines", map[string]any{
+		"name":                   "reports",
+		"rclone_remote":          remote.Id,
+		"rclone_path":            "/reports",
+		"stale_while_revalidate": true,
+	})
+	if !flight.ResolveStaleWhileRevalidate(app, remote, "reports/today.csv") {
+		t.Error("Expected pipeline to enable stale-while-revalidate")
+	}
+	if flight.ResolveStaleWhileRevalidate(app, remote, "archive/2020.csv") {
+		t.Error("Expected datasets outside the pipeline to stay disabled")
+	}
+
+	save("app_settings", map[string]any{"key": "stale_while_revalidate", "value": "true"})
+	if !flight.ResolveStaleWhileRevalidate(app, remote, "archive/2020.csv") {
+		t.Error("Expected app setting to enable stale-while-revalidate globally")
+	}
+}
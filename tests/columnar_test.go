@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/darianmavgo/flight3/internal/flight"
+	_ "modernc.org/sqlite"
+)
+
+// TestColumnarSources verifies that Parquet and Arrow IPC files convert with column types
+// taken from their schema, including Parquet files with several row groups.
+func TestColumnarSources(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_columnar_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Daily revenue as the analytics team exports it
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "region", Type: arrow.BinaryTypes.String},
+		{Name: "orders", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "revenue", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "day", Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}},
+		{Name: "closed", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+		{Name: "balance", Type: &arrow.Decimal128Type{Precision: 38, Scale: 2}},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	// More digits than a float holds
+	balances := []string{"12345678901234567890123.45", "0.05", "-7.10", "100.00", "3.14"}
+	for i, region := range []string{"north", "south", "east", "west", "central"} {
+		builder.Field(0).(*array.StringBuilder).Append(region)
+		builder.Field(1).(*array.Int64Builder).Append(int64(10 * (i + 1)))
+		builder.Field(2).(*array.Float64Builder).Append(float64(i) + 0.5)
+		builder.Field(3).(*array.TimestampBuilder).Append(arrow.Timestamp(day.UnixMilli()))
+		if i == 4 {
+			builder.Field(4).AppendNull()
+		} else {
+			builder.Field(4).(*array.BooleanBuilder).Append(i%2 == 0)
+		}
+		balance, err := decimal128.FromString(balances[i], 38, 2)
+		if err != nil {
+			t.Fatalf("Invalid balance %s: %v", balances[i], err)
+		}
+		builder.Field(5).(*array.Decimal128Builder).Append(balance)
+	}
+	record := builder.NewRecordBatch()
+	defer record.Release()
+
+	// Parquet, two rows per row group
+	parquetPath := filepath.Join(tempDir, "revenue.parquet")
+	f, err := os.Create(parquetPath)
+	if err != nil {
+		t.Fatalf("Failed to create parquet file: %v", err)
+	}
+	table := array.NewTableFromRecords(schema, []arrow.RecordBatch{record})
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(2))
+	if err := pqarrow.WriteTable(table, f, 2, props, pqarrow.DefaultWriterProps()); err != nil {
+		t.Fatalf("Failed to write parquet file: %v", err)
+	}
+	table.Release()
+
+	// Arrow IPC, extensionless file format and stream format
+	featherPath := filepath.Join(tempDir, "revenue")
+	writeIPC(t, featherPath, record, true)
+	streamPath := filepath.Join(tempDir, "revenue.arrows")
+	writeIPC(t, streamPath, record, false)
+
+	for _, tc := range []struct{ path, driver string }{
+		{parquetPath, "parquet"},
+		{featherPath, "arrow"},
+		{streamPath, "arrow"},
+	} {
+		dbPath := tc.path + ".db"
+		result, err := flight.ConvertSource(tc.path, dbPath, nil)
+		if err != nil {
+			t.Errorf("Converting %s failed: %v", filepath.Base(tc.path), err)
+			continue
+		}
+		if result.Driver != tc.driver {
+			t.Errorf("%s: expected driver %s, got %s", filepath.Base(tc.path), tc.driver, result.Driver)
+		}
+
+		db, err := sql.Open("sqlite", dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", dbPath, err)
+		}
+		types := map[string]string{}
+		rows, err := db.Query("SELECT name, type FROM pragma_table_info('tb0')")
+		if err != nil {
+			t.Fatalf("Failed to read schema of %s: %v", dbPath, err)
+		}
+		for rows.Next() {
+			var name, typ string
+			rows.Scan(&name, &typ)
+			types[name] = typ
+		}
+		rows.Close()
+
+		want := map[string]string{"region": "TEXT", "orders": "INTEGER", "revenue": "REAL", "day": "DATETIME", "closed": "INTEGER", "balance": "TEXT"}
+		for column, typ := range want {
+			if types[column] != typ {
+				t.Errorf("%s: column %s has type %q, want %q", filepath.Base(tc.path), column, types[column], typ)
+			}
+		}
+
+		var count int
+		var total int64
+		var maxRevenue float64
+		var firstDay string
+		var nulls int
+		db.QueryRow("SELECT COUNT(*), SUM(orders), MAX(revenue), MIN(day), SUM(closed IS NULL) FROM tb0").Scan(&count, &total, &maxRevenue, &firstDay, &nulls)
+		var stored []string
+		if rows, err := db.Query("SELECT balance FROM tb0 ORDER BY orders"); err == nil {
+			for rows.Next() {
+				var balance string
+				rows.Scan(&balance)
+				stored = append(stored, balance)
+			}
+			rows.Close()
+		}
+		db.Close()
+		if strings.Join(stored, " ") != strings.Join(balances, " ") {
+			t.Errorf("%s: expected exact decimals %v, got %v", filepath.Base(tc.path), balances, stored)
+		}
+		if count != 5 || total != 150 || maxRevenue != 4.5 || nulls != 1 {
+			t.Errorf("%s: got %d rows, orders %d, max revenue %v, %d nulls", filepath.Base(tc.path), count, total, maxRevenue, nulls)
+		}
+		if firstDay != "2026-03-01T00:00:00Z" {
+			t.Errorf("%s: expected RFC 3339 day, got %q", filepath.Base(tc.path), firstDay)
+		}
+	}
+}
+
+// writeIPC writes one record batch in the Arrow IPC file or stream format
+func writeIPC(t *testing.T, path string, record arrow.RecordBatch, fileFormat bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var w interface {
+		Write(arrow.RecordBatch) error
+		Close() error
+	}
+	if fileFormat {
+		if w, err = ipc.NewFileWriter(f, ipc.WithSchema(record.Schema())); err != nil {
+			t.Fatalf("Failed to create arrow writer: %v", err)
+		}
+	} else {
+		w = ipc.NewWriter(f, ipc.WithSchema(record.Schema()))
+	}
+	if err := w.Write(record); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close %s: %v", path, err)
+	}
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestMksqliteConfigArgs verifies that a pipeline's mksqlite_config (delimiter, header-less
+// columns, table name) and per-extension defaults are applied to conversions.
+func TestMksqliteConfigArgs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_mksqlite_config_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	save := func(collection string, data map[string]any) *core.Record {
+		col, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			t.Fatalf("Failed to find %s: %v", collection, err)
+		}
+		rec := core.NewRecord(col)
+		rec.Load(data)
+		if err := app.Save(rec); err != nil {
+			t.Fatalf("Failed to save %s record: %v", collection, err)
+		}
+		return rec
+	}
+
+	european := save("mksqlite_configs", map[string]any{
+		"name":   "european export",
+		"driver": "csv",
+		"args": map[string]any{
+			"delimiter":  ";",
+			"header":     false,
+			"columns":    []any{"region", "amount"},
+			"table_name": "sales",
+		},
+	})
+	save("data_pipelines", map[string]any{
+		"name":            "exports",
+		"rclone_path":     "/exports",
+		"mksqlite_config": european.Id,
+	})
+	save("mksqlite_configs", map[string]any{
+		"name":       "tab separated",
+		"extensions": "tsv, tab",
+		"driver":     "csv",
+		"args":       map[string]any{"delimiter": `\t`},
+	})
+
+	// Pipeline config wins, per-extension defaults apply elsewhere
+	opts := flight.ResolveConvertOptions(app, nil, "exports/2026-01.dat")
+	if opts == nil || opts.Name != "european export" {
+		t.Fatalf("Expected pipeline mksqlite_config, got %+v", opts)
+	}
+	if tsv := flight.ResolveConvertOptions(app, nil, "other/list.tsv"); tsv == nil || tsv.Name != "tab separated" {
+		t.Errorf("Expected per-extension default for .tsv, got %+v", tsv)
+	}
+	if none := flight.ResolveConvertOptions(app, nil, "other/list.csv"); none != nil {
+		t.Errorf("Expected no mksqlite_config for .csv, got %+v", none)
+	}
+
+	// Header-less, semicolon separated, unknown extension: only usable with the config
+	srcPath := filepath.Join(tempDir, "2026-01.dat")
+	if err := os.WriteFile(srcPath, []byte("north;10,5\nsouth;20,25\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	dbPath := filepath.Join(tempDir, "out.db")
+	result, err := flight.ConvertSource(srcPath, dbPath, opts)
+	if err != nil {
+		t.Fatalf("ConvertSource failed: %v", err)
+	}
+	if result.Driver != "csv" {
+		t.Errorf("Expected csv driver override, got %s", result.Driver)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open result: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sales").Scan(&count); err != nil {
+		t.Fatalf("Expected table 'sales': %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 data rows (no row consumed as header), got %d", count)
+	}
+	var amount string
+	if err := db.QueryRow("SELECT amount FROM sales WHERE region = 'south'").Scan(&amount); err != nil {
+		t.Fatalf("Expected named columns region/amount: %v", err)
+	}
+	if amount != "20,25" {
+		t.Errorf("Expected decimal comma value to survive, got %q", amount)
+	}
+
+	// Changing the config changes the fingerprint, so caches get rebuilt
+	before := opts.Hash()
+	european.Set("args", map[string]any{"delimiter": ","})
+	if err := app.Save(european); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if after := flight.ResolveConvertOptions(app, nil, "exports/2026-01.dat").Hash(); after == before {
+		t.Error("Expected options hash to change with the args")
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	_ "modernc.org/sqlite"
+)
+
+// TestDecompressedSources verifies that gzip, zstd and xz sources convert like their inner
+// file, detected by extension or, for extensionless downloads, by magic bytes.
+func TestDecompressedSources(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_decompress_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	csvData := []byte("name,amount\nalpha,1\nbeta,2\ngamma,3\n")
+
+	compress := map[string]func([]byte) []byte{
+		"gzip": func(data []byte) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(data []byte) []byte {
+			enc, _ := zstd.NewWriter(nil)
+			defer enc.Close()
+			return enc.EncodeAll(data, nil)
+		},
+		"xz": func(data []byte) []byte {
+			var buf bytes.Buffer
+			w, _ := xz.NewWriter(&buf)
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		},
+	}
+
+	cases := []struct {
+		file  string
+		codec string
+	}{
+		{"sales.csv.gz", "gzip"},
+		{"sales.csv.zst", "zstd"},
+		{"sales.csv.xz", "xz"},
+		{"download", "gzip"}, // no extension: magic bytes, then content sniffing
+	}
+
+	for _, tc := range cases {
+		srcPath := filepath.Join(tempDir, tc.file)
+		if err := os.WriteFile(srcPath, compress[tc.codec](csvData), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", tc.file, err)
+		}
+
+		driver, err := flight.DetectDriver(srcPath, "application/gzip")
+		if err != nil || driver != "csv" {
+			t.Errorf("%s: DetectDriver = %q, %v; want csv", tc.file, driver, err)
+			continue
+		}
+
+		dbPath := filepath.Join(tempDir, tc.file+".db")
+		if err := flight.ConvertToSQLite(srcPath, dbPath); err != nil {
+			t.Errorf("%s: conversion failed: %v", tc.file, err)
+			continue
+		}
+
+		db, err := sql.Open("sqlite", dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open result: %v", err)
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM tb0").Scan(&count); err != nil {
+			t.Errorf("%s: query failed: %v", tc.file, err)
+		} else if count != 3 {
+			t.Errorf("%s: expected 3 rows, got %d", tc.file, count)
+		}
+		db.Close()
+	}
+
+	// A compressed SQLite database is copied as-is after decompression
+	plainDB := filepath.Join(tempDir, "sales.csv.gz.db")
+	raw, err := os.ReadFile(plainDB)
+	if err != nil {
+		t.Fatalf("Failed to read converted database: %v", err)
+	}
+	packed := filepath.Join(tempDir, "snapshot.db.gz")
+	if err := os.WriteFile(packed, compress["gzip"](raw), 0644); err != nil {
+		t.Fatalf("Failed to write compressed database: %v", err)
+	}
+	if err := flight.ConvertToSQLite(packed, filepath.Join(tempDir, "snapshot.db")); err != nil {
+		t.Errorf("Compressed SQLite conversion failed: %v", err)
+	}
+
+	// Cache keys read like the inner file
+	if key := flight.LocalCacheKey(filepath.Join(tempDir, "sales.csv.gz")); !strings.Contains(key, "-sales.csv-") {
+		t.Errorf("Expected cache key to name the inner file, got %s", key)
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+)
+
+// TestDetectDriver verifies converter selection for extensionless and mislabeled sources.
+func TestDetectDriver(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_detect_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	writeZip := func(name string, members ...string) string {
+		path := filepath.Join(tempDir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		zw := zip.NewWriter(f)
+		for _, m := range members {
+			w, _ := zw.Create(m)
+			w.Write([]byte("<x/>"))
+		}
+		zw.Close()
+		f.Close()
+		return path
+	}
+
+	cases := []struct {
+		name        string
+		path        string
+		contentType string
+		want        string
+	}{
+		{"sqlite without extension", write("export", []byte("SQLite format 3\x00rest of header")), "", "sqlite"},
+		{"xlsx served as download", writeZip("download", "[Content_Types].xml", "xl/workbook.xml"), "application/octet-stream", "excel"},
+		{"xlsx mislabeled as csv", writeZip("report.csv", "xl/workbook.xml"), "", "excel"},
+		{"plain zip", writeZip("bundle", "a.csv", "b.csv"), "", "zip"},
+		{"html page", write("page", []byte("<!DOCTYPE html><html><body><table></table></body></html>")), "", "html"},
+		{"json api response", write("api", []byte(`  [{"id": 1}, {"id": 2}]`)), "", "json"},
+		{"markdown link is not json", write("notes.md", []byte("[docs](http://example.com)\n# Title\n")), "", "markdown"},
+		{"content type wins for ambiguous text", write("query", []byte("a b c\n")), "text/csv; charset=utf-8", "csv"},
+		{"semicolon csv without extension", write("download?id=7", []byte("region;amount\nnorth;10\nsouth;20\n")), "", "csv"},
+		{"csv mislabeled as txt", write("download.txt", []byte("a,b\nc,d\n")), "text/plain", "csv"},
+		{"tab separated txt", write("export.txt", []byte("id\tname\n1\talpha\n2\tbeta\n")), "", "csv"},
+		{"pipe separated dat", write("extract.dat", []byte("id|name\n1|alpha\n2|beta\n")), "", "csv"},
+		{"prose in txt", write("readme.txt", []byte("just some words\nwithout any structure\n")), "", "txt"},
+		{"empty txt", write("empty.txt", nil), "", "txt"},
+		{"free text", write("notes", []byte("just some words\nwithout any structure\n")), "", "txt"},
+	}
+
+	for _, tc := range cases {
+		got, err := flight.DetectDriver(tc.path, tc.contentType)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: DetectDriver = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := flight.DetectDriver(write("blob", []byte{0x00, 0x01, 0x02, 0xff}), ""); err == nil {
+		t.Error("Expected unrecognised binary content to be unsupported")
+	}
+
+	// End to end: an extensionless CSV converts instead of failing with "unsupported file type"
+	src := write("endpoint", []byte("name,amount\nalpha,1\nbeta,2\n"))
+	if err := flight.ConvertToSQLite(src, filepath.Join(tempDir, "out.db")); err != nil {
+		t.Errorf("ConvertToSQLite of extensionless CSV failed: %v", err)
+	}
+}
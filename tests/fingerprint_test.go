@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/darianmavgo/sqliter/sqliter"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSourceFingerprintEqual(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		a, b flight.SourceFingerprint
+		want bool
+	}{
+		{"SameModTimeAndSize", flight.SourceFingerprint{ModTime: now, Size: 10}, flight.SourceFingerprint{ModTime: now, Size: 10}, true},
+		{"SubSecondPrecision", flight.SourceFingerprint{ModTime: now.Add(300 * time.Millisecond), Size: 10}, flight.SourceFingerprint{ModTime: now, Size: 10}, true},
+		{"SizeChanged", flight.SourceFingerprint{ModTime: now, Size: 10}, flight.SourceFingerprint{ModTime: now, Size: 11}, false},
+		{"ModTimeChanged", flight.SourceFingerprint{ModTime: now, Size: 10}, flight.SourceFingerprint{ModTime: now.Add(time.Hour), Size: 10}, false},
+		{"HashWinsOverModTime", flight.SourceFingerprint{ModTime: now, Size: 10, HashType: "md5", Hash: "abc"}, flight.SourceFingerprint{ModTime: now.Add(time.Hour), Size: 10, HashType: "md5", Hash: "abc"}, true},
+		{"HashChanged", flight.SourceFingerprint{ModTime: now, Size: 10, HashType: "md5", Hash: "abc"}, flight.SourceFingerprint{ModTime: now, Size: 10, HashType: "md5", Hash: "def"}, false},
+		{"NoModTime", flight.SourceFingerprint{Size: 10}, flight.SourceFingerprint{Size: 10}, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceUnchanged(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fingerprint_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cachePath := filepath.Join(tempDir, "test.db")
+	fp := flight.SourceFingerprint{ModTime: time.Now().UTC(), Size: 42}
+
+	// No cache file yet
+	if flight.SourceUnchanged(cachePath, fp) {
+		t.Error("Expected missing cache to be reported as changed")
+	}
+
+	if err := os.WriteFile(cachePath, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create cache file: %v", err)
+	}
+
+	// Cache without a recorded fingerprint (built by an older version)
+	if flight.SourceUnchanged(cachePath, fp) {
+		t.Error("Expected cache without fingerprint to be reported as changed")
+	}
+
+	if err := flight.WriteFingerprint(cachePath, fp); err != nil {
+		t.Fatalf("Failed to write fingerprint: %v", err)
+	}
+	if !flight.SourceUnchanged(cachePath, fp) {
+		t.Error("Expected matching fingerprint to be reported as unchanged")
+	}
+
+	changed := fp
+	changed.Size++
+	if flight.SourceUnchanged(cachePath, changed) {
+		t.Error("Expected different size to be reported as changed")
+	}
+}
+
+// TestCacheHitSourceChange verifies that a remote file changed within the cache TTL is
+// rebuilt on the next hit that checks its source, instead of being served until expiry,
+// and that local datasets report X-Flight-Cache as well.
+func TestCacheHitSourceChange(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_source_change_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dataDir := filepath.Join(tempDir, "data")
+	os.MkdirAll(dataDir, 0755)
+	csvPath := filepath.Join(dataDir, "sales.csv")
+	if err := os.WriteFile(csvPath, []byte("region,total\nnorth,1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	defer flight.GetRcloneManager().Shutdown()
+	flight.SetSQLiterServer(sqliter.NewServer(sqliter.DefaultConfig()))
+
+	save := func(collection string, data map[string]any) {
+		col, _ := app.FindCollectionByNameOrId(collection)
+		record := core.NewRecord(col)
+		record.Load(data)
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to save %s record: %v", collection, err)
+		}
+	}
+	// A TTL far longer than the test; the directory cache must not hide the change
+	save("rclone_remotes", map[string]any{"name": "disk", "type": "local", "enabled": true, "root": dataDir,
+		"cache_ttl": 1440, "vfs_settings": map[string]any{"dir_cache_time": "0s"}})
+	save("app_settings", map[string]any{"key": "source_check_interval", "value": "0"})
+	save("app_settings", map[string]any{"key": "serve_folder", "value": dataDir})
+
+	requestURI := func(uri string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RequestURI = uri
+		rec := httptest.NewRecorder()
+		e := &core.RequestEvent{App: app}
+		e.Request, e.Response = req, rec
+		if err := flight.HandleBanquet(e, false); err != nil {
+			t.Fatalf("HandleBanquet failed: %v", err)
+		}
+		return rec.Header().Get("X-Flight-Cache")
+	}
+	request := func() string { return requestURI("http://localhost/local:/disk/sales.csv") }
+
+	if status := request(); status != "miss" {
+		t.Errorf("Expected the first request to build the cache, got %q", status)
+	}
+	if status := request(); status != "hit" {
+		t.Errorf("Expected an unchanged source to be a hit, got %q", status)
+	}
+
+	if err := os.WriteFile(csvPath, []byte("region,total\nnorth,1\nsouth,2\n"), 0644); err != nil {
+		t.Fatalf("Failed to update CSV: %v", err)
+	}
+	if status := request(); status != "miss" {
+		t.Errorf("Expected the changed source to be rebuilt within the TTL, got %q", status)
+	}
+	if status := request(); status != "hit" {
+		t.Errorf("Expected the rebuilt cache to be a hit, got %q", status)
+	}
+
+	// Local datasets report the same header
+	if status := requestURI("http://localhost/sales.csv"); status != "miss" {
+		t.Errorf("Expected the first local request to build the cache, got %q", status)
+	}
+	if status := requestURI("http://localhost/sales.csv"); status != "hit" {
+		t.Errorf("Expected the second local request to be a hit, got %q", status)
+	}
+}
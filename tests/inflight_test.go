@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+)
+
+// TestConcurrentLocalConversion verifies that concurrent conversions of the same
+// source through the shared build path produce one valid database.
+func TestConcurrentLocalConversion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "inflight_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	csvPath := filepath.Join(tempDir, "data.csv")
+	if err := os.WriteFile(csvPath, []byte("a,b\n1,2\n3,4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write csv: %v", err)
+	}
+	cachePath := filepath.Join(tempDir, "data.db")
+
+	var builds int32
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := flight.DedupBuild("data", time.Minute, func() error {
+				if valid, _ := flight.ValidateCache(cachePath, 1440); valid {
+					return nil
+				}
+				atomic.AddInt32(&builds, 1)
+				return flight.ConvertToSQLite(csvPath, cachePath)
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Build failed: %v", err)
+		}
+	}
+	if builds != 1 {
+		t.Errorf("Expected exactly 1 conversion, got %d", builds)
+	}
+}
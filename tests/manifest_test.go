@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestCacheManifest verifies cache_entries bookkeeping: builds create or update a record,
+// hits are buffered until flushed and survive rebuilds, and entries can be removed.
+func TestCacheManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_manifest_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	cachePath := filepath.Join(tempDir, "sales.db")
+	if err := os.WriteFile(cachePath, []byte("cached"), 0644); err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+	entry := flight.CacheEntry{
+		CacheKey:    "v2-sales.csv-0123",
+		CachePath:   cachePath,
+		SourceURL:   "s3://sales/sales.csv",
+		SourcePath:  "/sales.csv",
+		Fingerprint: "md5:abc/6",
+		Driver:      "csv",
+		BuildTime:   1500 * time.Millisecond,
+	}
+	find := func() *core.Record {
+		record, err := app.FindFirstRecordByData("cache_entries", "cache_key", entry.CacheKey)
+		if err != nil {
+			t.Fatalf("Cache entry not found: %v", err)
+		}
+		return record
+	}
+
+	// 1. A build creates the record
+	if err := flight.RecordCacheBuild(app, entry); err != nil {
+		t.Fatalf("RecordCacheBuild failed: %v", err)
+	}
+	record := find()
+	if record.GetInt("size_bytes") != 6 || record.GetString("converter") != "csv" || record.GetInt("build_ms") != 1500 ||
+		record.GetString("source_fingerprint") != "md5:abc/6" || record.GetDateTime("built_at").IsZero() {
+		t.Errorf("Unexpected cache entry: %v", record.FieldsData())
+	}
+	builtAccess := record.GetDateTime("last_access")
+
+	// 2. Hits are buffered in memory until flushed
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		flight.RecordCacheHit(app, entry.CacheKey)
+	}
+	flight.RecordCacheHit(app, "v2-never-built-4567")
+	if hits := find().GetInt("hit_count"); hits != 0 {
+		t.Errorf("Expected hits to wait for a flush, got %d", hits)
+	}
+	if err := flight.FlushCacheHits(app); err != nil {
+		t.Fatalf("FlushCacheHits failed: %v", err)
+	}
+	record = find()
+	if hits := record.GetInt("hit_count"); hits != 3 {
+		t.Errorf("Expected 3 hits after the flush, got %d", hits)
+	}
+	if !record.GetDateTime("last_access").After(builtAccess) {
+		t.Errorf("Expected the flush to advance last_access")
+	}
+	if err := flight.FlushCacheHits(app); err != nil || find().GetInt("hit_count") != 3 {
+		t.Errorf("Expected a second flush to add nothing (err %v)", err)
+	}
+
+	// 3. A rebuild updates the record in place and keeps the hit count
+	entry.Fingerprint = "md5:def/6"
+	if err := flight.RecordCacheBuild(app, entry); err != nil {
+		t.Fatalf("Second RecordCacheBuild failed: %v", err)
+	}
+	if records, _ := app.FindAllRecords("cache_entries"); len(records) != 1 {
+		t.Errorf("Expected the rebuild to update the only record, got %d records", len(records))
+	}
+	if record := find(); record.GetInt("hit_count") != 3 || record.GetString("source_fingerprint") != "md5:def/6" {
+		t.Errorf("Unexpected cache entry after rebuild: %v", record.FieldsData())
+	}
+
+	// 4. Removal
+	if err := flight.RemoveCacheEntry(app, entry.CacheKey); err != nil {
+		t.Fatalf("RemoveCacheEntry failed: %v", err)
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", entry.CacheKey); err == nil {
+		t.Error("Expected the cache entry to be removed")
+	}
+	if err := flight.RemoveCacheEntry(app, entry.CacheKey); err != nil {
+		t.Errorf("Expected removing a missing entry to succeed, got %v", err)
+	}
+}
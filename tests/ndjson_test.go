@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	_ "modernc.org/sqlite"
+)
+
+// TestNDJSONSources verifies JSON Lines conversion: the union of the fields of all records,
+// nested objects flattened into dotted columns and arrays spilled into child tables.
+func TestNDJSONSources(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_ndjson_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Event log; later records bring fields the first one lacks
+	events := strings.Join([]string{
+		`{"event":"login","user":{"id":1,"address":{"city":"Oslo"}},"tags":["web"]}`,
+		`{"event":"purchase","user":{"id":2,"address":{"city":"Lima"}},"amount":19.5,"tags":["app","promo"]}`,
+		`{"event":"logout","user":{"id":1},"session":null,"items":[{"sku":"A1","qty":2}]}`,
+		``,
+	}, "\n")
+	eventsPath := filepath.Join(tempDir, "events.jsonl")
+	if err := os.WriteFile(eventsPath, []byte(events), 0644); err != nil {
+		t.Fatalf("Failed to write events: %v", err)
+	}
+
+	// Detected from content without the extension
+	rawPath := filepath.Join(tempDir, "export")
+	os.WriteFile(rawPath, []byte(events), 0644)
+	if driver, err := flight.DetectDriver(rawPath, ""); err != nil || driver != "ndjson" {
+		t.Errorf("Expected ndjson from content, got %q (%v)", driver, err)
+	}
+
+	// 1. Defaults: everything flattened, arrays kept as JSON text
+	flatDB := filepath.Join(tempDir, "flat.db")
+	result, err := flight.ConvertSource(eventsPath, flatDB, nil)
+	if err != nil {
+		t.Fatalf("Converting events failed: %v", err)
+	}
+	if result.Driver != "ndjson" {
+		t.Errorf("Expected ndjson driver, got %s", result.Driver)
+	}
+	columns := tableColumns(t, flatDB, "tb0")
+	if got := strings.Join(columns, ","); got != "event,user.id,user.address.city,tags,amount,items" {
+		t.Errorf("Unexpected union schema: %s", got)
+	}
+	if n := countRows(t, flatDB, `SELECT COUNT(*) FROM tb0 WHERE "user.address.city" = 'Lima' AND amount = 19.5`); n != 1 {
+		t.Error("Expected the flattened city and amount of the purchase")
+	}
+	if n := countRows(t, flatDB, `SELECT COUNT(*) FROM tb0 WHERE tags = '["app","promo"]'`); n != 1 {
+		t.Error("Expected arrays as JSON text")
+	}
+
+	// 2. One level of flattening, arrays in child tables
+	opts := &flight.ConvertOptions{Args: map[string]any{"flatten_depth": 1, "array_tables": true}}
+	nestedDB := filepath.Join(tempDir, "nested.db")
+	if _, err := flight.ConvertSource(eventsPath, nestedDB, opts); err != nil {
+		t.Fatalf("Converting events with array_tables failed: %v", err)
+	}
+	if n := countRows(t, nestedDB, `SELECT COUNT(*) FROM tb0 WHERE "user.address" = '{"city":"Oslo"}'`); n != 1 {
+		t.Error("Expected objects past flatten_depth as JSON text")
+	}
+	if n := countRows(t, nestedDB, `SELECT COUNT(*) FROM tb0_tags t JOIN tb0 p ON p._id = t._parent_id WHERE p.event = 'purchase'`); n != 2 {
+		t.Errorf("Expected 2 tags linked to the purchase, got %d", n)
+	}
+	if n := countRows(t, nestedDB, `SELECT COUNT(*) FROM tb0_tags WHERE value = 'promo' AND _index = 1`); n != 1 {
+		t.Error("Expected the array position in _index")
+	}
+	if n := countRows(t, nestedDB, `SELECT COUNT(*) FROM tb0_items WHERE sku = 'A1' AND qty = 2 AND _parent_id = 3`); n != 1 {
+		t.Error("Expected array objects flattened into the child table")
+	}
+
+	// 3. Fields SQLite would see as the same column: names differing in case, a dotted key
+	// next to the nested field it flattens like, and a field called _id
+	clashes := strings.Join([]string{
+		`{"id":1,"ID":"a-1","a.b":"literal","a":{"b":"nested"}}`,
+		`{"Id":2,"a":{"b":"nested"},"a.b":"literal","_id":"x"}`,
+	}, "\n")
+	clashPath := filepath.Join(tempDir, "clashes.jsonl")
+	os.WriteFile(clashPath, []byte(clashes), 0644)
+	clashDB := filepath.Join(tempDir, "clashes.db")
+	if _, err := flight.ConvertSource(clashPath, clashDB, &flight.ConvertOptions{Args: map[string]any{"array_tables": true}}); err != nil {
+		t.Fatalf("Converting clashing fields failed: %v", err)
+	}
+	if got := strings.Join(tableColumns(t, clashDB, "tb0"), ","); got != "_id,id,ID_2,a.b,a.b_2,Id_3,_id_2" {
+		t.Errorf("Unexpected disambiguated columns: %s", got)
+	}
+	if n := countRows(t, clashDB, `SELECT COUNT(*) FROM tb0 WHERE "a.b" = 'literal' AND "a.b_2" = 'nested'`); n != 2 {
+		t.Errorf("Expected the dotted key and the nested field in their own columns, got %d rows", n)
+	}
+	if n := countRows(t, clashDB, `SELECT COUNT(*) FROM tb0 WHERE id = 1 AND ID_2 = 'a-1' AND Id_3 IS NULL`); n != 1 {
+		t.Error("Expected fields differing in case in their own columns")
+	}
+
+	// 4. Arrays that would spill into the same child table: a.b next to a literal a_b, and
+	// d of the child table tb0_c next to a literal c_d
+	children := `{"a":{"b":[1,2]},"a_b":[3,4,5],"c":[{"d":[6]}],"c_d":[7,8]}`
+	childrenPath := filepath.Join(tempDir, "children.jsonl")
+	os.WriteFile(childrenPath, []byte(children), 0644)
+	childrenDB := filepath.Join(tempDir, "children.db")
+	if _, err := flight.ConvertSource(childrenPath, childrenDB, &flight.ConvertOptions{Args: map[string]any{"array_tables": true}}); err != nil {
+		t.Fatalf("Converting clashing child tables failed: %v", err)
+	}
+	tables, err := flight.DataTables(childrenDB)
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	if got := strings.Join(tables, ","); got != "tb0,tb0_a_b,tb0_a_b_2,tb0_c,tb0_c_d,tb0_c_d_2" {
+		t.Errorf("Unexpected disambiguated child tables: %s", got)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM tb0_a_b WHERE value IN (1, 2)`:      2,
+		`SELECT COUNT(*) FROM tb0_a_b_2 WHERE value IN (3, 4, 5)`: 3,
+		`SELECT COUNT(*) FROM tb0_c_d WHERE value = 6`:            1,
+		`SELECT COUNT(*) FROM tb0_c_d_2 WHERE value IN (7, 8)`:    2,
+	} {
+		if n := countRows(t, childrenDB, query); n != want {
+			t.Errorf("%s: got %d rows, want %d", query, n, want)
+		}
+	}
+}
+
+// tableColumns returns the column names of a table in order
+func tableColumns(t *testing.T, dbPath, table string) []string {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("Failed to read columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		columns = append(columns, name)
+	}
+	return columns
+}
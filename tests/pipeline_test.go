@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestPipelineScheduling verifies schedule validation, cron job sync and a local pipeline run.
+func TestPipelineScheduling(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_pipeline_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+
+	// A run cut short by a crash or restart
+	pipelines, _ := app.FindCollectionByNameOrId("data_pipelines")
+	interrupted := core.NewRecord(pipelines)
+	interrupted.Load(map[string]any{"name": "nightly", "rclone_path": "nightly.csv", "last_status": flight.PipelineStatusRunning})
+	if err := app.Save(interrupted); err != nil {
+		t.Fatalf("Failed to save interrupted pipeline: %v", err)
+	}
+
+	flight.StartPipelineScheduler(app)
+
+	// 0. Starting the scheduler doesn't leave it running forever
+	interrupted, _ = app.FindRecordById("data_pipelines", interrupted.Id)
+	if interrupted.GetString("last_status") != flight.PipelineStatusFailed || interrupted.GetString("last_error") == "" {
+		t.Errorf("Expected the interrupted run to be marked failed, got %q (%q)",
+			interrupted.GetString("last_status"), interrupted.GetString("last_error"))
+	}
+
+	// Local dataset served from serve_folder
+	serveDir := filepath.Join(tempDir, "data")
+	if err := os.MkdirAll(serveDir, 0755); err != nil {
+		t.Fatalf("Failed to create serve folder: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(serveDir, "sales.csv"), []byte("region,amount\nnorth,10\nsouth,20\n"), 0644); err != nil {
+		t.Fatalf("Failed to write csv: %v", err)
+	}
+
+	settings, _ := app.FindCollectionByNameOrId("app_settings")
+	setting := core.NewRecord(settings)
+	setting.Load(map[string]any{"key": "serve_folder", "value": serveDir})
+	if err := app.Save(setting); err != nil {
+		t.Fatalf("Failed to save serve_folder: %v", err)
+	}
+
+	pipeline := core.NewRecord(pipelines)
+	pipeline.Load(map[string]any{
+		"name":        "morning sales",
+		"rclone_path": "sales.csv",
+		"schedule":    "not a cron expression",
+	})
+
+	// 1. Invalid schedules are rejected
+	if err := app.Save(pipeline); err == nil || !strings.Contains(err.Error(), "schedule") {
+		t.Fatalf("Expected schedule validation error, got %v", err)
+	}
+
+	// 2. Valid schedules register a cron job
+	pipeline.Set("schedule", "0 6 * * 1-5")
+	if err := app.Save(pipeline); err != nil {
+		t.Fatalf("Failed to save pipeline: %v", err)
+	}
+	if !hasCronJob(app, "flight_pipeline_"+pipeline.Id, "0 6 * * 1-5") {
+		t.Error("Expected cron job for scheduled pipeline")
+	}
+
+	// 3. Running the pipeline builds the cache a request would use
+	if err := flight.RunPipeline(app, pipeline); err != nil {
+		t.Fatalf("RunPipeline failed: %v", err)
+	}
+	localPath := flight.ResolveLocalPath(app, "sales.csv")
+	cacheKey := flight.LocalCacheKey(localPath)
+	if _, err := os.Stat(filepath.Join(app.DataDir(), "cache", cacheKey+".db")); err != nil {
+		t.Errorf("Expected warmed cache file: %v", err)
+	}
+	if entry, err := app.FindFirstRecordByData("cache_entries", "cache_key", cacheKey); err != nil {
+		t.Errorf("Expected cache_entries record for warmed cache: %v", err)
+	} else if entry.GetString("source_url") != "sales.csv" {
+		t.Errorf("Expected the source_url a request for /sales.csv records, got %q", entry.GetString("source_url"))
+	}
+
+	// 4. An unchanged source only renews the cache; a changed one is rebuilt
+	cachePath := filepath.Join(app.DataDir(), "cache", cacheKey+".db")
+	built, _ := os.Stat(cachePath)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(cachePath, old, old)
+	if err := flight.RunPipeline(app, pipeline); err != nil {
+		t.Fatalf("RunPipeline with unchanged source failed: %v", err)
+	}
+	renewed, err := os.Stat(cachePath)
+	if err != nil || !os.SameFile(built, renewed) || !renewed.ModTime().After(old) {
+		t.Errorf("Expected the cache of an unchanged source to be renewed in place")
+	}
+	if err := os.WriteFile(filepath.Join(serveDir, "sales.csv"), []byte("region,amount\nnorth,10\n"), 0644); err != nil {
+		t.Fatalf("Failed to update csv: %v", err)
+	}
+	if err := flight.RunPipeline(app, pipeline); err != nil {
+		t.Fatalf("RunPipeline with changed source failed: %v", err)
+	}
+	if rebuilt, err := os.Stat(cachePath); err != nil || os.SameFile(renewed, rebuilt) {
+		t.Errorf("Expected the cache of a changed source to be rebuilt")
+	}
+
+	// 5. Clearing the schedule removes the job
+	pipeline.Set("schedule", "")
+	if err := app.Save(pipeline); err != nil {
+		t.Fatalf("Failed to update pipeline: %v", err)
+	}
+	for _, job := range app.Cron().Jobs() {
+		if job.Id() == "flight_pipeline_"+pipeline.Id {
+			t.Error("Expected cron job to be removed")
+		}
+	}
+}
+
+func hasCronJob(app core.App, id, expr string) bool {
+	for _, job := range app.Cron().Jobs() {
+		if job.Id() == id && job.Expression() == expr {
+			return true
+		}
+	}
+	return false
+}
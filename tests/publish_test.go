@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	_ "modernc.org/sqlite"
+)
+
+// TestConvertPublishesAtomically verifies a failed rebuild leaves the previous cache intact
+// and that no partial build files are left next to it.
+func TestConvertPublishesAtomically(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "publish_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	csvPath := filepath.Join(tempDir, "data.csv")
+	if err := os.WriteFile(csvPath, []byte("name,amount\nalpha,1\nbeta,2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write csv: %v", err)
+	}
+	cacheDir := filepath.Join(tempDir, "cache")
+	cachePath := filepath.Join(cacheDir, "data.db")
+
+	if err := flight.ConvertToSQLite(csvPath, cachePath); err != nil {
+		t.Fatalf("ConvertToSQLite failed: %v", err)
+	}
+
+	// A "SQLite" source that is not a database must fail the integrity check
+	badPath := filepath.Join(tempDir, "broken.db")
+	if err := os.WriteFile(badPath, []byte("definitely not sqlite"), 0644); err != nil {
+		t.Fatalf("Failed to write broken db: %v", err)
+	}
+	if err := flight.ConvertToSQLite(badPath, cachePath); err == nil {
+		t.Fatal("Expected conversion of a corrupt database to fail")
+	}
+
+	// The previously published cache is still served
+	db, err := sql.Open("sqlite", cachePath)
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	defer db.Close()
+
+	var tableCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table'").Scan(&tableCount); err != nil {
+		t.Fatalf("Cache is no longer a valid database: %v", err)
+	}
+	if tableCount == 0 {
+		t.Error("Expected the original converted table to survive the failed rebuild")
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to read cache dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Errorf("Partial build left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestCleanupStaleBuilds(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "stale_builds_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	stale := filepath.Join(tempDir, ".data.db.12345.building")
+	journal := stale + "-journal"
+	keep := filepath.Join(tempDir, "data.db")
+	for _, p := range []string{stale, journal, keep} {
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", p, err)
+		}
+	}
+
+	flight.CleanupStaleBuilds(tempDir)
+
+	for _, p := range []string{stale, journal} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", filepath.Base(p))
+		}
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("Expected published cache to be kept: %v", err)
+	}
+}
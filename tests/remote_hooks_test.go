@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestRemoteRecordHooks verifies that editing or deleting an rclone_remotes record drops its
+// VFS instance and, when the source changed, the caches built from it.
+func TestRemoteRecordHooks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_remote_hooks_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	rm := flight.GetRcloneManager()
+	defer rm.Shutdown()
+	flight.WatchRemotes(app)
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	remote := core.NewRecord(remotes)
+	remote.Load(map[string]any{"name": "disk", "type": "local", "enabled": true})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to save remote: %v", err)
+	}
+
+	// fakeCache records a cache built from the remote
+	fakeCache := func(name string) string {
+		cachePath := filepath.Join(pbDataDir, "cache", name+".db")
+		os.WriteFile(cachePath, []byte("cache"), 0644)
+		err := flight.RecordCacheBuild(app, flight.CacheEntry{CacheKey: name, CachePath: cachePath, RemoteID: remote.Id, SourcePath: "/" + name})
+		if err != nil {
+			t.Fatalf("Failed to record cache entry: %v", err)
+		}
+		return cachePath
+	}
+	cachePath := fakeCache("sales")
+
+	first, err := rm.GetVFS(remote)
+	if err != nil {
+		t.Fatalf("GetVFS failed: %v", err)
+	}
+
+	// 1. Unrelated fields keep the VFS
+	remote.Set("description", "Local disk")
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to update description: %v", err)
+	}
+	if n := rm.VFSCount(); n != 1 {
+		t.Errorf("Expected the VFS to survive a description edit, %d live", n)
+	}
+
+	// 2. vfs_settings: a new VFS, caches kept; an instance in use keeps working until released
+	_, release, err := rm.AcquireVFS(remote)
+	if err != nil {
+		t.Fatalf("AcquireVFS failed: %v", err)
+	}
+	remote.Set("vfs_settings", map[string]any{"cache_mode": "off"})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to update vfs_settings: %v", err)
+	}
+	if n := rm.VFSCount(); n != 0 {
+		t.Errorf("Expected the VFS to be dropped after a vfs_settings edit, %d live", n)
+	}
+	if _, err := first.Stat("/"); err != nil {
+		t.Errorf("Expected the retired VFS to keep serving its lease: %v", err)
+	}
+	release()
+	second, err := rm.GetVFS(remote)
+	if err != nil {
+		t.Fatalf("GetVFS after edit failed: %v", err)
+	}
+	if second == first {
+		t.Error("Expected a new VFS for the new vfs_settings")
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Error("Expected caches to be kept after a vfs_settings edit")
+	}
+
+	// 3. A reconfiguration that is rolled back keeps the caches
+	err = app.RunInTransaction(func(txApp core.App) error {
+		stored, err := txApp.FindRecordById("rclone_remotes", remote.Id)
+		if err != nil {
+			return err
+		}
+		stored.Set("config", map[string]any{"one_file_system": "true"})
+		if err := txApp.Save(stored); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("Expected the transaction to roll back, got %v", err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Error("Expected caches to be kept when the edit is rolled back")
+	}
+
+	// 4. An edit to a freshly loaded record compares against its stored state
+	stored, err := app.FindRecordById("rclone_remotes", remote.Id)
+	if err != nil {
+		t.Fatalf("Failed to load remote: %v", err)
+	}
+	stored.Set("description", "Local disk, loaded")
+	if err := app.Save(stored); err != nil {
+		t.Fatalf("Failed to update loaded remote: %v", err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Error("Expected caches to be kept after a description edit")
+	}
+	remote = stored
+
+	// 5. config: caches are purged
+	remote.Set("config", map[string]any{"one_file_system": "true"})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("Expected the cache to be purged after a config edit")
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", "sales"); err == nil {
+		t.Error("Expected the cache entry to be removed after a config edit")
+	}
+
+	// 6. Delete: VFS and caches go
+	rm.GetVFS(remote)
+	cachePath = fakeCache("orders")
+	if err := app.Delete(remote); err != nil {
+		t.Fatalf("Failed to delete remote: %v", err)
+	}
+	if n := rm.VFSCount(); n != 0 {
+		t.Errorf("Expected no VFS after deleting the remote, %d live", n)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("Expected the cache to be purged with the remote")
+	}
+	if _, err := app.FindFirstRecordByData("cache_entries", "cache_key", "orders"); err == nil {
+		t.Error("Expected the cache entry to be removed with the remote")
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestRemoteRoot verifies that remotes can be scoped to a root: a path, the legacy "root"
+// config key, an rclone connection string with on-the-fly options, or another remote's
+// root ("disk:analytics/public").
+func TestRemoteRoot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_remote_root_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dataDir := filepath.Join(tempDir, "data")
+	os.MkdirAll(filepath.Join(dataDir, "analytics", "public"), 0755)
+	os.WriteFile(filepath.Join(dataDir, "secret.csv"), []byte("a\n1\n"), 0644)
+	os.WriteFile(filepath.Join(dataDir, "analytics", "public", "report.csv"), []byte("a\n1\n"), 0644)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	rm := flight.GetRcloneManager()
+	defer rm.Shutdown()
+	flight.WatchRemotes(app)
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	save := func(data map[string]any) (*core.Record, error) {
+		record := core.NewRecord(remotes)
+		record.Load(map[string]any{"type": "local", "enabled": true})
+		record.Load(data)
+		return record, app.Save(record)
+	}
+	mustSave := func(data map[string]any) *core.Record {
+		record, err := save(data)
+		if err != nil {
+			t.Fatalf("Failed to save remote %v: %v", data["name"], err)
+		}
+		return record
+	}
+	// sees reports whether a remote's VFS has the file at remotePath
+	sees := func(record *core.Record, remotePath string) bool {
+		resolved, err := flight.ResolveRemote(app, record)
+		if err != nil {
+			t.Fatalf("ResolveRemote(%s) failed: %v", record.GetString("name"), err)
+		}
+		v, err := rm.GetVFS(resolved)
+		if err != nil {
+			t.Fatalf("GetVFS(%s) failed: %v", record.GetString("name"), err)
+		}
+		_, err = v.Stat(remotePath)
+		return err == nil
+	}
+
+	disk := mustSave(map[string]any{"name": "disk", "root": dataDir})
+	legacy := mustSave(map[string]any{"name": "legacy", "config": map[string]any{"root": dataDir}})
+	inline := mustSave(map[string]any{"name": "inline", "root": ":local,one_file_system=true:" + filepath.Join(dataDir, "analytics")})
+	public := mustSave(map[string]any{"name": "public", "root": "disk,case_insensitive=true:analytics/public"})
+	nested := mustSave(map[string]any{"name": "nested", "root": "public:"})
+
+	for _, tc := range []struct {
+		remote *core.Record
+		path   string
+		want   bool
+	}{
+		{disk, "secret.csv", true},
+		{legacy, "secret.csv", true},
+		{inline, "public/report.csv", true},
+		{inline, "secret.csv", false},
+		{public, "report.csv", true},
+		{public, "secret.csv", false},
+		{public, "../secret.csv", false},
+		{nested, "report.csv", true},
+	} {
+		if got := sees(tc.remote, tc.path); got != tc.want {
+			t.Errorf("%s sees %s: %v, want %v", tc.remote.GetString("name"), tc.path, got, tc.want)
+		}
+	}
+
+	// The scoped remote takes the base's config with its own options on top
+	resolved, _ := flight.ResolveRemote(app, public)
+	if config := resolved.GetString("config"); !strings.Contains(config, `"case_insensitive":"true"`) {
+		t.Errorf("Expected the on-the-fly option in the resolved config, got %s", config)
+	}
+	if resolved.Id != public.Id {
+		t.Errorf("Expected the resolved remote to keep its id")
+	}
+
+	// Sources that can't be resolved are refused on save, on the field at fault
+	for _, tc := range []struct {
+		data  map[string]any
+		field string
+	}{
+		{map[string]any{"name": "unknown", "root": "nowhere:data"}, "root"},
+		{map[string]any{"name": "loop", "root": "loop:data"}, "root"},
+		{map[string]any{"name": "backend", "root": ":s3:bucket"}, "root"},
+		{map[string]any{"name": "mismatch", "type": "http", "root": "disk:analytics"}, "type"},
+		{map[string]any{"name": "listconfig", "config": []any{"one_file_system"}}, "config"},
+	} {
+		_, err := save(tc.data)
+		if err == nil {
+			t.Errorf("Expected %v to be refused", tc.data)
+			continue
+		}
+		var errs validation.Errors
+		if !errors.As(err, &errs) || errs[tc.field] == nil || len(errs) != 1 {
+			t.Errorf("Expected the error on %s for %v, got %v", tc.field, tc.data, err)
+		}
+	}
+
+	// Reconfiguring the base purges the caches of the remotes scoped into it
+	cachePath := filepath.Join(pbDataDir, "cache", "report.db")
+	os.WriteFile(cachePath, []byte("cache"), 0644)
+	err = flight.RecordCacheBuild(app, flight.CacheEntry{CacheKey: "report", CachePath: cachePath, RemoteID: nested.Id, SourcePath: "/report.csv"})
+	if err != nil {
+		t.Fatalf("Failed to record cache entry: %v", err)
+	}
+	disk.Set("config", map[string]any{"one_file_system": "true"})
+	if err := app.Save(disk); err != nil {
+		t.Fatalf("Failed to update base remote: %v", err)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("Expected the cache of a remote scoped into the base to be purged")
+	}
+}
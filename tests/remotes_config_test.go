@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/rclone/rclone/fs/config/obscure"
+
+	// A backend with password options
+	_ "github.com/rclone/rclone/backend/crypt"
+)
+
+// TestRemotesConfig verifies importing an rclone.conf into rclone_remotes (aliases as roots,
+// obscured passwords, duplicates and updates) and exporting it back.
+func TestRemotesConfig(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_remotes_config_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	flight.WatchRemotes(app)
+
+	obscured := obscure.MustObscure("hunter2")
+	conf := `# team remotes
+[public]
+type = alias
+remote = disk:analytics/public
+
+[disk]
+type = local
+copy_links = true
+
+[vault]
+type = crypt
+remote = disk:vault
+password = plain-secret
+password2 = ` + obscured + `
+
+[srv]
+type = alias
+remote = /srv/data
+
+[inline]
+type = alias
+remote = :local,copy_links=true:/srv/shared
+
+[copy]
+type = local
+copy_links = true
+
+[broken]
+copy_links = true
+
+[dangling]
+type = alias
+remote = nowhere:data
+`
+	sorted := func(names []string) []string {
+		names = append([]string(nil), names...)
+		sort.Strings(names)
+		return names
+	}
+
+	// 1. First import
+	result, err := flight.ImportRemotes(app, strings.NewReader(conf), flight.RemoteImport{})
+	if err != nil {
+		t.Fatalf("ImportRemotes failed: %v", err)
+	}
+	if got, want := sorted(result.Created), []string{"disk", "inline", "public", "srv", "vault"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Created %v, want %v", got, want)
+	}
+	if result.Duplicates["copy"] != "disk" {
+		t.Errorf("Expected copy to be a duplicate of disk, got %v", result.Duplicates)
+	}
+	if result.Errors["broken"] == "" || result.Errors["dangling"] == "" {
+		t.Errorf("Expected errors for broken and dangling, got %v", result.Errors)
+	}
+
+	public, err := app.FindFirstRecordByData("rclone_remotes", "name", "public")
+	if err != nil {
+		t.Fatalf("public not imported: %v", err)
+	}
+	if public.GetString("type") != "local" || public.GetString("root") != "disk:analytics/public" {
+		t.Errorf("Expected the alias as a local remote scoped into disk, got type %q root %q", public.GetString("type"), public.GetString("root"))
+	}
+	srv, _ := app.FindFirstRecordByData("rclone_remotes", "name", "srv")
+	if srv == nil || srv.GetString("root") != "/srv/data" {
+		t.Errorf("Expected srv rooted at /srv/data")
+	}
+
+	vault, _ := app.FindFirstRecordByData("rclone_remotes", "name", "vault")
+	if vault == nil {
+		t.Fatal("vault not imported")
+	}
+	config := map[string]string{}
+	vault.UnmarshalJSONField("config", &config)
+	if revealed, err := obscure.Reveal(config["password"]); err != nil || revealed != "plain-secret" {
+		t.Errorf("Expected the plain text password to be obscured, got %q", config["password"])
+	}
+	if config["password2"] != obscured {
+		t.Errorf("Expected the obscured password to be kept, got %q", config["password2"])
+	}
+
+	// 2. Importing again changes nothing
+	result, err = flight.ImportRemotes(app, strings.NewReader(conf), flight.RemoteImport{})
+	if err != nil {
+		t.Fatalf("Second ImportRemotes failed: %v", err)
+	}
+	if len(result.Created) != 0 || len(result.Unchanged) != 5 {
+		t.Errorf("Expected 5 unchanged remotes, got %+v", result)
+	}
+
+	// 3. Changed sections are conflicts until --update; --dry-run saves nothing
+	changed := strings.Replace(conf, "copy_links = true\n\n[vault]", "copy_links = false\n\n[vault]", 1)
+	result, _ = flight.ImportRemotes(app, strings.NewReader(changed), flight.RemoteImport{})
+	if !reflect.DeepEqual(result.Conflicts, []string{"disk"}) {
+		t.Errorf("Expected disk to conflict, got %v", result.Conflicts)
+	}
+	result, _ = flight.ImportRemotes(app, strings.NewReader(changed), flight.RemoteImport{Update: true, DryRun: true})
+	if !reflect.DeepEqual(result.Updated, []string{"disk"}) {
+		t.Errorf("Expected disk to be reported as updated, got %v", result.Updated)
+	}
+	disk, _ := app.FindFirstRecordByData("rclone_remotes", "name", "disk")
+	if !strings.Contains(disk.GetString("config"), `"copy_links":"true"`) {
+		t.Errorf("Expected a dry run to keep the config, got %s", disk.GetString("config"))
+	}
+	result, _ = flight.ImportRemotes(app, strings.NewReader(changed), flight.RemoteImport{Update: true})
+	disk, _ = app.FindFirstRecordByData("rclone_remotes", "name", "disk")
+	if !reflect.DeepEqual(result.Updated, []string{"disk"}) || !strings.Contains(disk.GetString("config"), `"copy_links":"false"`) {
+		t.Errorf("Expected disk to be updated, got %v with config %s", result.Updated, disk.GetString("config"))
+	}
+
+	// 4. Export writes sections rclone reads; roots become aliases
+	var out bytes.Buffer
+	if err := flight.ExportRemotes(app, nil, &out); err != nil {
+		t.Fatalf("ExportRemotes failed: %v", err)
+	}
+	exported := out.String()
+	for _, want := range []string{
+		"[disk]\ntype = local\ncopy_links = false\n",
+		"[public]\ntype = alias\nremote = disk:analytics/public\n",
+		"[srv]\ntype = alias\nremote = /srv/data\n",
+		"[inline]\ntype = alias\nremote = :local,copy_links=true:/srv/shared\n",
+		"password2 = " + obscured + "\n",
+	} {
+		if !strings.Contains(exported, want) {
+			t.Errorf("Expected the export to contain %q, got:\n%s", want, exported)
+		}
+	}
+
+	// Importing the export round-trips
+	result, err = flight.ImportRemotes(app, strings.NewReader(exported), flight.RemoteImport{})
+	if err != nil {
+		t.Fatalf("Importing the export failed: %v", err)
+	}
+	if len(result.Unchanged) != 5 || len(result.Created)+len(result.Updated)+len(result.Conflicts)+len(result.Errors) != 0 {
+		t.Errorf("Expected the export to round-trip unchanged, got %+v", result)
+	}
+
+	out.Reset()
+	if err := flight.ExportRemotes(app, []string{"public"}, &out); err != nil {
+		t.Fatalf("ExportRemotes by name failed: %v", err)
+	}
+	if strings.Contains(out.String(), "[disk]") || !strings.Contains(out.String(), "[public]") {
+		t.Errorf("Expected only public to be exported, got:\n%s", out.String())
+	}
+	if err := flight.ExportRemotes(app, []string{"missing"}, &out); !errors.Is(err, flight.ErrRemoteNotFound) {
+		t.Errorf("Expected ErrRemoteNotFound exporting an unknown remote, got %v", err)
+	}
+	if _, err := flight.ImportRemotes(app, strings.NewReader("RCLONE_ENCRYPT_V0:\nabc"), flight.RemoteImport{}); !errors.Is(err, flight.ErrInvalidRcloneConfig) {
+		t.Errorf("Expected ErrInvalidRcloneConfig importing an encrypted config, got %v", err)
+	}
+}
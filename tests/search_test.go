@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/darianmavgo/sqliter/sqliter"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestSearchIndex verifies the fts arg: converted tables get an FTS5 index over their text
+// columns, and SearchWhere turns search terms into a WHERE clause matching through it.
+func TestSearchIndex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_search_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	csvPath := filepath.Join(tempDir, "tickets.csv")
+	content := strings.Join([]string{
+		"id,title,status",
+		"1,Printer on fire,open",
+		"2,Password reset,closed",
+		"3,Printing queue stuck,open",
+		"4,Laptop won't boot,open",
+		"",
+	}, "\n")
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	// Without the arg there is nothing to search
+	plainDB := filepath.Join(tempDir, "plain.db")
+	if _, err := flight.ConvertSource(csvPath, plainDB, nil); err != nil {
+		t.Fatalf("Converting without fts failed: %v", err)
+	}
+	if _, err := flight.SearchWhere(plainDB, "", "printer"); !errors.Is(err, flight.ErrNoSearchIndex) {
+		t.Errorf("Expected ErrNoSearchIndex without fts, got %v", err)
+	}
+
+	dbPath := filepath.Join(tempDir, "tickets.db")
+	opts := &flight.ConvertOptions{Args: map[string]any{"fts": true, "infer_types": true}}
+	if _, err := flight.ConvertSource(csvPath, dbPath, opts); err != nil {
+		t.Fatalf("Converting with fts failed: %v", err)
+	}
+
+	// Only columns that stayed TEXT are indexed
+	if columns := strings.Join(tableColumns(t, dbPath, "tb0_fts"), ","); columns != "title,status" {
+		t.Errorf("Expected the index over title,status, got %s", columns)
+	}
+
+	for _, tc := range []struct {
+		term string
+		want int
+	}{
+		{"printer", 1},
+		{"print*", 2},
+		{"open print*", 2},
+		{"won't", 1},
+		{"AND", 0}, // searched as a word, not an FTS5 operator
+		{"closed printer", 0},
+	} {
+		where, err := flight.SearchWhere(dbPath, "tb0", tc.term)
+		if err != nil {
+			t.Errorf("SearchWhere(%q) failed: %v", tc.term, err)
+			continue
+		}
+		if n := countRows(t, dbPath, "SELECT COUNT(*) FROM tb0 WHERE "+where); n != tc.want {
+			t.Errorf("Search %q matched %d rows, want %d", tc.term, n, tc.want)
+		}
+	}
+
+	if _, err := flight.SearchWhere(dbPath, "orders", "printer"); !errors.Is(err, flight.ErrNoSearchIndex) {
+		t.Errorf("Expected ErrNoSearchIndex for a table without index, got %v", err)
+	}
+
+	// The index and its shadow tables are not data tables
+	if tables, err := flight.DataTables(dbPath); err != nil || strings.Join(tables, ",") != "tb0" {
+		t.Errorf("Expected tb0 as the only data table, got %v (err %v)", tables, err)
+	}
+
+	// SQLite sources are copied with an index too; a full-text table of their own is left alone
+	sourcePath := filepath.Join(tempDir, "helpdesk.db")
+	db, err := sql.Open("sqlite", sourcePath)
+	if err != nil {
+		t.Fatalf("Failed to create SQLite source: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE tickets (id INTEGER, title TEXT)",
+		"INSERT INTO tickets VALUES (1, 'Printer on fire'), (2, 'Password reset')",
+		"CREATE VIRTUAL TABLE notes USING fts5(body)",
+		"INSERT INTO notes VALUES ('printer toner ordered')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to prepare SQLite source (%s): %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	copyPath := filepath.Join(tempDir, "helpdesk.copy.db")
+	if _, err := flight.ConvertSource(sourcePath, copyPath, &flight.ConvertOptions{Args: map[string]any{"fts": true}}); err != nil {
+		t.Fatalf("Copying SQLite with fts failed: %v", err)
+	}
+	if tables, err := flight.DataTables(copyPath); err != nil || strings.Join(tables, ",") != "tickets" {
+		t.Errorf("Expected tickets as the only data table, got %v (err %v)", tables, err)
+	}
+	where, err := flight.SearchWhere(copyPath, "", "printer")
+	if err != nil {
+		t.Fatalf("Expected the copied tickets to be searchable: %v", err)
+	}
+	if n := countRows(t, copyPath, "SELECT COUNT(*) FROM tickets WHERE "+where); n != 1 {
+		t.Errorf("Search of the copied tickets matched %d rows, want 1", n)
+	}
+	if n := countRows(t, copyPath, "SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'notes%_fts'"); n != 0 {
+		t.Error("Expected no index over the source's own full-text tables")
+	}
+}
+
+// TestSearchRequests verifies requests for datasets with a search index: a request naming no
+// table opens the only data table, and SQLite files of local remotes are copied rather than
+// linked so the index is not written into the source.
+func TestSearchRequests(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_search_requests_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dataDir := filepath.Join(tempDir, "data")
+	os.MkdirAll(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "tickets.csv"), []byte("id,title\n1,Printer on fire\n2,Password reset\n"), 0644)
+	db, err := sql.Open("sqlite", filepath.Join(dataDir, "helpdesk.db"))
+	if err != nil {
+		t.Fatalf("Failed to create SQLite source: %v", err)
+	}
+	db.Exec("CREATE TABLE tickets (id INTEGER, title TEXT); INSERT INTO tickets VALUES (1, 'Printer on fire')")
+	db.Close()
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	defer flight.GetRcloneManager().Shutdown()
+	flight.SetSQLiterServer(sqliter.NewServer(sqliter.DefaultConfig()))
+
+	save := func(collection string, data map[string]any) {
+		col, _ := app.FindCollectionByNameOrId(collection)
+		record := core.NewRecord(col)
+		record.Load(data)
+		if err := app.Save(record); err != nil {
+			t.Fatalf("Failed to save %s record: %v", collection, err)
+		}
+	}
+	save("app_settings", map[string]any{"key": "serve_folder", "value": dataDir})
+	save("rclone_remotes", map[string]any{"name": "disk", "type": "local", "enabled": true, "root": dataDir})
+	save("mksqlite_configs", map[string]any{"name": "searchable", "extensions": "csv, db", "args": map[string]any{"fts": true}})
+
+	request := func(uri string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		req.RequestURI = uri
+		e := &core.RequestEvent{App: app}
+		e.Request, e.Response = req, httptest.NewRecorder()
+		if err := flight.HandleBanquet(e, false); err != nil {
+			t.Fatalf("HandleBanquet(%s) failed: %v", uri, err)
+		}
+		return e.Request
+	}
+
+	// 1. No table named: SQLiter is sent to tb0 rather than a listing with the index in it
+	req := request("/tickets.csv?q=printer")
+	if path, _, _ := strings.Cut(req.RequestURI, "?"); path != "/tickets.csv/tb0" {
+		t.Errorf("Expected the request to open tb0, got %s", req.RequestURI)
+	}
+	if !strings.Contains(req.URL.RawQuery, "tb0_fts") {
+		t.Errorf("Expected the search to run against tb0, got %s", req.URL.RawQuery)
+	}
+	if req := request("/tickets.csv/tb0"); req.RequestURI != "/tickets.csv/tb0" {
+		t.Errorf("Expected a named table to be kept, got %s", req.RequestURI)
+	}
+
+	// 2. A SQLite file of a local remote is copied and indexed, the source stays untouched
+	request("http://localhost/local:/disk/helpdesk.db?q=printer")
+	cacheKey, cachePath, err := flight.CacheURLLocation(app, "http://localhost/local:/disk/helpdesk.db")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v (%s)", err, cacheKey)
+	}
+	if info, err := os.Lstat(cachePath); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("Expected a copy of the SQLite source (err %v)", err)
+	}
+	if n := countRows(t, cachePath, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'tickets_fts'"); n != 1 {
+		t.Error("Expected the copy to have a search index")
+	}
+	if n := countRows(t, filepath.Join(dataDir, "helpdesk.db"), "SELECT COUNT(*) FROM sqlite_master WHERE name LIKE '%_fts%'"); n != 0 {
+		t.Error("Expected no search index in the source database")
+	}
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/darianmavgo/sqliter/sqliter"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestConvertReader verifies converting sources straight from a stream: row formats and
+// SQLite without a temp copy, ZIP through a spool file that is removed afterwards.
+func TestConvertReader(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_stream_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	spoolDir := filepath.Join(tempDir, "temp")
+
+	var csvGz bytes.Buffer
+	gz := gzip.NewWriter(&csvGz)
+	gz.Write([]byte("region,amount\nnorth,10\nsouth,20\n"))
+	gz.Close()
+
+	sqlitePath := filepath.Join(tempDir, "source.db")
+	db, err := sql.Open("sqlite", sqlitePath)
+	if err != nil {
+		t.Fatalf("Failed to create SQLite source: %v", err)
+	}
+	db.Exec("CREATE TABLE orders (id INTEGER); INSERT INTO orders VALUES (1), (2), (3)")
+	db.Close()
+	sqliteData, _ := os.ReadFile(sqlitePath)
+
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(name))
+	}
+	zw.Close()
+
+	cases := []struct {
+		name   string
+		data   []byte
+		driver string
+		query  string
+		rows   int
+	}{
+		{"sales.csv.gz", csvGz.Bytes(), "csv", "SELECT COUNT(*) FROM tb0", 2},
+		{"orders.db", sqliteData, "sqlite", "SELECT COUNT(*) FROM orders", 3},
+		{"bundle.zip", zipData.Bytes(), "zip", "SELECT COUNT(*) FROM file_list", 2},
+	}
+	for _, tc := range cases {
+		destPath := filepath.Join(tempDir, tc.name+".out.db")
+		result, err := flight.ConvertReader(bytes.NewReader(tc.data), tc.name, destPath, spoolDir, nil)
+		if err != nil {
+			t.Errorf("ConvertReader(%s) failed: %v", tc.name, err)
+			continue
+		}
+		if result.Driver != tc.driver {
+			t.Errorf("ConvertReader(%s) used driver %s, want %s", tc.name, result.Driver, tc.driver)
+		}
+		if n := countRows(t, destPath, tc.query); n != tc.rows {
+			t.Errorf("ConvertReader(%s) produced %d rows, want %d", tc.name, n, tc.rows)
+		}
+	}
+
+	if leftovers, _ := os.ReadDir(spoolDir); len(leftovers) != 0 {
+		t.Errorf("Expected spool files to be removed, found %d", len(leftovers))
+	}
+}
+
+// TestLocalRemoteSQLiteInPlace verifies that a SQLite file on a local remote is served
+// through a link to the source instead of a copy in the cache.
+func TestLocalRemoteSQLiteInPlace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_inplace_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Local remotes are rooted at the working directory
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	db, err := sql.Open("sqlite", filepath.Join(tempDir, "orders.db"))
+	if err != nil {
+		t.Fatalf("Failed to create SQLite source: %v", err)
+	}
+	db.Exec("CREATE TABLE orders (id INTEGER); INSERT INTO orders VALUES (1), (2)")
+	db.Close()
+	sourceModTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(tempDir, "orders.db"), sourceModTime, sourceModTime)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	remote := core.NewRecord(remotes)
+	remote.Load(map[string]any{"name": "disk", "type": "local", "enabled": true})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to save remote: %v", err)
+	}
+	pipelines, _ := app.FindCollectionByNameOrId("data_pipelines")
+	pipeline := core.NewRecord(pipelines)
+	// A TTL that expires before the second request
+	pipeline.Load(map[string]any{"name": "orders", "rclone_remote": remote.Id, "rclone_path": "orders.db", "cache_ttl": 0.001})
+	if err := app.Save(pipeline); err != nil {
+		t.Fatalf("Failed to save pipeline: %v", err)
+	}
+
+	if err := flight.RunPipeline(app, pipeline); err != nil {
+		t.Fatalf("RunPipeline failed: %v", err)
+	}
+
+	entry, err := app.FindFirstRecordByData("cache_entries", "source_path", "/orders.db")
+	if err != nil {
+		t.Fatalf("Expected a cache entry for orders.db: %v", err)
+	}
+	cachePath := entry.GetString("cache_path")
+	info, err := os.Lstat(cachePath)
+	if err != nil {
+		t.Fatalf("Cache database missing: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the cache to link to the source database")
+	}
+	if n := countRows(t, cachePath, "SELECT COUNT(*) FROM orders"); n != 2 {
+		t.Errorf("Expected 2 rows through the link, got %d", n)
+	}
+
+	// An expired link is renewed without touching the source database
+	flight.SetSQLiterServer(sqliter.NewServer(sqliter.DefaultConfig()))
+	time.Sleep(100 * time.Millisecond)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RequestURI = "http://localhost/local:/disk/orders.db"
+	rec := httptest.NewRecorder()
+	e := &core.RequestEvent{App: app}
+	e.Request, e.Response = req, rec
+	if err := flight.HandleBanquet(e, false); err != nil {
+		t.Fatalf("HandleBanquet failed: %v", err)
+	}
+	if status := rec.Header().Get("X-Flight-Cache"); status != "revalidated" {
+		t.Errorf("Expected the expired link to be revalidated, got %q", status)
+	}
+	source, err := os.Stat(filepath.Join(tempDir, "orders.db"))
+	if err != nil {
+		t.Fatalf("Source database missing: %v", err)
+	}
+	if !source.ModTime().Equal(sourceModTime) {
+		t.Errorf("Expected the source modification time to stay %s, got %s", sourceModTime, source.ModTime())
+	}
+	if valid, err := flight.ValidateCache(cachePath, 1); err != nil || !valid {
+		t.Errorf("Expected the renewed link to be fresh (err %v)", err)
+	}
+	if info, err := os.Lstat(cachePath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the renewed cache to still link to the source")
+	}
+}
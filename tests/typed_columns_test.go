@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestTypedListings verifies that directory listings store size, mod_time and is_dir with
+// numeric and date affinities, so they sort by value instead of lexicographically.
+func TestTypedListings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_typed_listing_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// "9" sorts after "10" as text
+	reports := filepath.Join(tempDir, "reports")
+	os.MkdirAll(filepath.Join(reports, "archive"), 0755)
+	os.WriteFile(filepath.Join(reports, "small.csv"), []byte("123456789"), 0644)
+	os.WriteFile(filepath.Join(reports, "large.csv"), []byte("1234567890"), 0644)
+
+	// Local remotes are rooted at the working directory
+	wd, _ := os.Getwd()
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	remote := core.NewRecord(remotes)
+	remote.Load(map[string]any{"name": "disk", "type": "local", "enabled": true})
+	if err := app.Save(remote); err != nil {
+		t.Fatalf("Failed to save remote: %v", err)
+	}
+
+	rm := flight.GetRcloneManager()
+	v, err := rm.GetVFS(remote)
+	if err != nil {
+		t.Fatalf("Failed to get VFS: %v", err)
+	}
+
+	// 1. IndexDirectory
+	listingDB := filepath.Join(tempDir, "listing.db")
+	if err := rm.IndexDirectory(v, "reports", listingDB); err != nil {
+		t.Fatalf("IndexDirectory failed: %v", err)
+	}
+
+	// 2. Local directories through mksqlite's filesystem converter
+	walkDB := filepath.Join(tempDir, "walk.db")
+	if _, err := flight.ConvertSource(reports, walkDB, nil); err != nil {
+		t.Fatalf("Converting the directory failed: %v", err)
+	}
+
+	for _, dbPath := range []string{listingDB, walkDB} {
+		types := columnTypes(t, dbPath, "tb0")
+		for column, want := range map[string]string{"size": "INTEGER", "mod_time": "DATETIME", "is_dir": "INTEGER"} {
+			if types[column] != want {
+				t.Errorf("%s: column %s has type %q, want %q", filepath.Base(dbPath), column, types[column], want)
+			}
+		}
+		if n := countRows(t, dbPath, "SELECT COUNT(*) FROM (SELECT name FROM tb0 WHERE is_dir = 0 ORDER BY size DESC LIMIT 1) WHERE name = 'large.csv'"); n != 1 {
+			t.Errorf("%s: expected large.csv to sort first by size", filepath.Base(dbPath))
+		}
+	}
+	if n := countRows(t, listingDB, "SELECT COUNT(*) FROM tb0 WHERE is_dir = 1 AND name = 'archive'"); n != 1 {
+		t.Error("Expected the archive folder flagged as a directory")
+	}
+}
+
+// TestInferColumnTypes verifies the infer_types arg: columns whose sampled values all parse
+// become INTEGER, REAL or DATETIME while zero padded codes and mixed columns stay TEXT.
+func TestInferColumnTypes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_infer_types_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	csvPath := filepath.Join(tempDir, "shipments.csv")
+	content := strings.Join([]string{
+		"id,weight,shipped,zip,note,ref",
+		"9,2.5,2026-01-05,02134,fragile,7",
+		"10,12,2026-01-06T08:30:00Z,10001,,8",
+		"11,,2026-01-07,94105,42,A-9",
+		"",
+	}, "\n")
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	// Without the arg everything stays TEXT
+	plainDB := filepath.Join(tempDir, "plain.db")
+	if _, err := flight.ConvertSource(csvPath, plainDB, nil); err != nil {
+		t.Fatalf("Converting without inference failed: %v", err)
+	}
+	if types := columnTypes(t, plainDB, "tb0"); types["id"] != "TEXT" {
+		t.Errorf("Expected id as TEXT without infer_types, got %q", types["id"])
+	}
+
+	typedDB := filepath.Join(tempDir, "typed.db")
+	opts := &flight.ConvertOptions{Args: map[string]any{"infer_types": true}}
+	if _, err := flight.ConvertSource(csvPath, typedDB, opts); err != nil {
+		t.Fatalf("Converting with inference failed: %v", err)
+	}
+	types := columnTypes(t, typedDB, "tb0")
+	want := map[string]string{"id": "INTEGER", "weight": "REAL", "shipped": "DATETIME", "zip": "TEXT", "note": "TEXT", "ref": "TEXT"}
+	for column, typ := range want {
+		if types[column] != typ {
+			t.Errorf("Column %s has type %q, want %q", column, types[column], typ)
+		}
+	}
+
+	if n := countRows(t, typedDB, "SELECT COUNT(*) FROM (SELECT id FROM tb0 ORDER BY id DESC LIMIT 1) WHERE id = 11"); n != 1 {
+		t.Error("Expected ids to sort numerically")
+	}
+	if n := countRows(t, typedDB, "SELECT COUNT(*) FROM tb0 WHERE weight IS NULL"); n != 1 {
+		t.Error("Expected the empty weight as NULL")
+	}
+	if n := countRows(t, typedDB, "SELECT COUNT(*) FROM tb0 WHERE zip = '02134'"); n != 1 {
+		t.Error("Expected the zero padded zip code kept as text")
+	}
+
+	// A sample of one value types ref as INTEGER; the value that does not parse keeps its text
+	sampledDB := filepath.Join(tempDir, "sampled.db")
+	opts = &flight.ConvertOptions{Args: map[string]any{"infer_types": true, "infer_sample": 1, "table_name": "shipments"}}
+	if _, err := flight.ConvertSource(csvPath, sampledDB, opts); err != nil {
+		t.Fatalf("Converting with a small sample failed: %v", err)
+	}
+	if types := columnTypes(t, sampledDB, "shipments"); types["ref"] != "INTEGER" || types["note"] != "TEXT" {
+		t.Errorf("Unexpected types with infer_sample 1: %v", types)
+	}
+	if n := countRows(t, sampledDB, "SELECT COUNT(*) FROM shipments WHERE ref = 'A-9' AND typeof(ref) = 'text'"); n != 1 {
+		t.Error("Expected the unparsed ref kept as text")
+	}
+}
+
+// columnTypes returns the declared type of each column of a table
+func columnTypes(t *testing.T, dbPath, table string) map[string]string {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("Failed to read schema of %s: %v", dbPath, err)
+	}
+	defer rows.Close()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		rows.Scan(&name, &typ)
+		types[name] = typ
+	}
+	return types
+}
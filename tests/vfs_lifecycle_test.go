@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TestVFSLifecycle verifies the VFS instance cap, that leased instances are never shut down,
+// idle eviction and the shutdown of all instances.
+func TestVFSLifecycle(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_vfs_lifecycle_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	rm := flight.GetRcloneManager()
+	defer rm.Shutdown()
+
+	// Two local remotes with different configs get their own instances
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+	first := core.NewRecord(remotes)
+	first.Load(map[string]any{"name": "first", "type": "local", "enabled": true})
+	second := core.NewRecord(remotes)
+	second.Load(map[string]any{"name": "second", "type": "local", "enabled": true,
+		"config": map[string]any{"one_file_system": "true"}})
+
+	// 1. The cap refuses a new instance while the only live one is in use
+	rm.SetVFSLimits(time.Hour, 1)
+	_, releaseFirst, err := rm.AcquireVFS(first)
+	if err != nil {
+		t.Fatalf("AcquireVFS failed: %v", err)
+	}
+	if _, _, err := rm.AcquireVFS(second); !errors.Is(err, flight.ErrVFSLimit) {
+		t.Errorf("Expected ErrVFSLimit while the only instance is leased, got %v", err)
+	}
+
+	// 2. Once released, the idle instance makes room
+	releaseFirst()
+	_, releaseSecond, err := rm.AcquireVFS(second)
+	if err != nil {
+		t.Fatalf("AcquireVFS after release failed: %v", err)
+	}
+	if n := rm.VFSCount(); n != 1 {
+		t.Errorf("Expected 1 live instance under the cap, got %d", n)
+	}
+
+	// 3. Idle eviction skips leased instances
+	rm.SetVFSLimits(time.Millisecond, 0)
+	time.Sleep(5 * time.Millisecond)
+	if n := rm.EvictIdleVFS(); n != 0 {
+		t.Errorf("Expected the leased instance to survive idle eviction, %d evicted", n)
+	}
+	releaseSecond()
+	time.Sleep(5 * time.Millisecond)
+	if n := rm.EvictIdleVFS(); n != 1 {
+		t.Errorf("Expected the released instance to be evicted, %d evicted", n)
+	}
+
+	// 4. Repeated use of a remote shares its instance; Shutdown stops everything
+	if _, err := rm.GetVFS(first); err != nil {
+		t.Fatalf("GetVFS failed: %v", err)
+	}
+	if _, err := rm.GetVFS(first); err != nil {
+		t.Fatalf("GetVFS failed: %v", err)
+	}
+	if n := rm.VFSCount(); n != 1 {
+		t.Errorf("Expected one shared instance, got %d", n)
+	}
+	rm.Shutdown()
+	if n := rm.VFSCount(); n != 0 {
+		t.Errorf("Expected no instances after Shutdown, got %d", n)
+	}
+}
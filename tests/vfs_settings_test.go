@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// TestVFSSettings verifies that vfs_settings of a remote override the VFS defaults in rclone's
+// duration and size syntax, and that settings rclone can't parse are refused on save.
+func TestVFSSettings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_vfs_settings_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pbDataDir := filepath.Join(tempDir, "pb_data")
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: pbDataDir,
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	if err := flight.InitRclone(filepath.Join(pbDataDir, "cache")); err != nil {
+		t.Fatalf("Failed to initialize rclone: %v", err)
+	}
+	rm := flight.GetRcloneManager()
+	defer rm.Shutdown()
+	flight.WatchRemotes(app)
+
+	remotes, _ := app.FindCollectionByNameOrId("rclone_remotes")
+
+	// 1. Defaults without vfs_settings
+	plain := core.NewRecord(remotes)
+	plain.Load(map[string]any{"name": "plain", "type": "local", "enabled": true})
+	if err := app.Save(plain); err != nil {
+		t.Fatalf("Failed to save remote: %v", err)
+	}
+	v, err := rm.GetVFS(plain)
+	if err != nil {
+		t.Fatalf("GetVFS failed: %v", err)
+	}
+	if v.Opt.CacheMode != vfscommon.CacheModeFull || v.Opt.DirCacheTime != fs.Duration(10*time.Minute) ||
+		v.Opt.CacheMaxAge != fs.Duration(24*time.Hour) || v.Opt.ChunkSize != 128*fs.Mebi {
+		t.Errorf("Unexpected default VFS options: mode %v, dir cache %v, max age %v, chunk %v",
+			v.Opt.CacheMode, v.Opt.DirCacheTime, v.Opt.CacheMaxAge, v.Opt.ChunkSize)
+	}
+
+	// 2. Settings in rclone syntax, read back from the database as JSON
+	tuned := core.NewRecord(remotes)
+	tuned.Load(map[string]any{"name": "tuned", "type": "local", "enabled": true,
+		"vfs_settings": map[string]any{
+			"cache_mode":             "writes",
+			"dir_cache_time":         "1m",
+			"vfs_cache_max_age":      "2h",
+			"cache_max_size":         "10G",
+			"chunk_size":             1048576, // JSON numbers are bytes
+			"chunk_size_limit":       "off",
+			"poll_interval":          30, // and seconds
+			"no_modtime":             true,
+			"read_ahead":             "16M",
+			"vfs_case_insensitive":   "true",
+			"vfs_write_back":         "10s",
+			"vfs_read_chunk_streams": 4,
+		}})
+	if err := app.Save(tuned); err != nil {
+		t.Fatalf("Failed to save remote with vfs_settings: %v", err)
+	}
+	stored, err := app.FindRecordById("rclone_remotes", tuned.Id)
+	if err != nil {
+		t.Fatalf("Failed to reload remote: %v", err)
+	}
+	v, err = rm.GetVFS(stored)
+	if err != nil {
+		t.Fatalf("GetVFS failed: %v", err)
+	}
+	opt := v.Opt
+	for _, check := range []struct {
+		name      string
+		got, want any
+	}{
+		{"cache_mode", opt.CacheMode, vfscommon.CacheModeWrites},
+		{"dir_cache_time", opt.DirCacheTime, fs.Duration(time.Minute)},
+		{"cache_max_age", opt.CacheMaxAge, fs.Duration(2 * time.Hour)},
+		{"cache_max_size", opt.CacheMaxSize, 10 * fs.Gibi},
+		{"chunk_size", opt.ChunkSize, fs.Mebi},
+		{"chunk_size_limit", opt.ChunkSizeLimit, fs.SizeSuffix(-1)},
+		{"poll_interval", opt.PollInterval, fs.Duration(30 * time.Second)},
+		{"no_modtime", opt.NoModTime, true},
+		{"read_ahead", opt.ReadAhead, 16 * fs.Mebi},
+		{"case_insensitive", opt.CaseInsensitive, true},
+		{"write_back", opt.WriteBack, fs.Duration(10 * time.Second)},
+		{"chunk_streams", opt.ChunkStreams, 4},
+	} {
+		if check.got != check.want {
+			t.Errorf("%s: got %v, want %v", check.name, check.got, check.want)
+		}
+	}
+
+	// 3. Invalid settings are refused on save
+	for _, settings := range []map[string]any{
+		{"cache_mode": "everything"},
+		{"dir_cache_time": "ten minutes"},
+		{"cache_max_size": "big"},
+		{"no_modtime": "maybe"},
+		{"cache_size": "1G"},
+		{"chunk_size": "1M", "vfs_read_chunk_size": "2M"},
+	} {
+		bad := core.NewRecord(remotes)
+		bad.Load(map[string]any{"name": "bad", "type": "local", "enabled": true, "vfs_settings": settings})
+		err := app.Save(bad)
+		if err == nil {
+			t.Errorf("Expected vfs_settings %v to be refused", settings)
+			continue
+		}
+		if !strings.Contains(err.Error(), "vfs_settings") {
+			t.Errorf("Expected the error on vfs_settings for %v, got %v", settings, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darianmavgo/banquet"
+	"github.com/darianmavgo/flight3/internal/flight"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	_ "modernc.org/sqlite"
+)
+
+// TestZipMembers verifies addressing files and folders inside a zip archive through the
+// banquet path: members convert as their own datasets and folders list like directories.
+func TestZipMembers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "flight3_zip_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	expand := []struct{ column, dataset, rest, table string }{
+		{"inner/sales.csv", "/export.zip/inner/sales.csv", "", ""},
+		{"inner/sales.xlsx/Sheet1", "/export.zip/inner/sales.xlsx", "Sheet1", "Sheet1"},
+		{"inner", "/export.zip/inner", "", ""},
+		{"sales.csv/tb0/+amount", "/export.zip/sales.csv", "tb0/+amount", "tb0"},
+		{"file_list", "/export.zip", "file_list", "file_list"},
+	}
+	for _, tc := range expand {
+		b := &banquet.Banquet{DataSetPath: "/export.zip", ColumnPath: tc.column, Table: tc.table}
+		flight.ExpandArchivePath(b)
+		if b.DataSetPath != tc.dataset || b.ColumnPath != tc.rest || b.Table != tc.table {
+			t.Errorf("ExpandArchivePath(%q) = %q, %q, %q; want %q, %q, %q",
+				tc.column, b.DataSetPath, b.ColumnPath, b.Table, tc.dataset, tc.rest, tc.table)
+		}
+	}
+
+	// Export with a nested folder, as downloaded from a reporting tool
+	serveDir := filepath.Join(tempDir, "data")
+	if err := os.MkdirAll(serveDir, 0755); err != nil {
+		t.Fatalf("Failed to create serve folder: %v", err)
+	}
+	f, err := os.Create(filepath.Join(serveDir, "export.zip"))
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string]string{
+		"inner/sales.csv":      "region,amount\nnorth,10\nsouth,20\n",
+		"inner/2026/notes.txt": "january\n",
+		"README.txt":           "export\n",
+		"v1.2/data.csv":        "id,amount\n1,5\n2,6\n3,7\n",
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	f.Close()
+
+	// The archive's listing settles what the path alone can't: dotted folders, tables after folders
+	resolve := []struct{ column, dataset, rest, table string }{
+		{"v1.2/data.csv", "/export.zip/v1.2/data.csv", "", ""},
+		{"v1.2/data.csv/tb0/+amount", "/export.zip/v1.2/data.csv", "tb0/+amount", "tb0"},
+		{"v1.2", "/export.zip/v1.2", "", "tb0"},
+		{"inner", "/export.zip/inner", "", "tb0"},
+		{"inner/tb0", "/export.zip/inner", "tb0", "tb0"},
+		{"inner/2026/notes.txt", "/export.zip/inner/2026/notes.txt", "", ""},
+		{"v1.2/missing.csv", "/export.zip/v1.2/missing.csv", "", ""},
+	}
+	for _, tc := range resolve {
+		b := &banquet.Banquet{DataSetPath: "/export.zip", ColumnPath: tc.column}
+		flight.ExpandArchivePath(b)
+		if err := flight.ResolveArchiveMember(b, filepath.Join(serveDir, "export.zip")); err != nil {
+			t.Fatalf("ResolveArchiveMember(%q): %v", tc.column, err)
+		}
+		if b.DataSetPath != tc.dataset || b.ColumnPath != tc.rest || b.Table != tc.table {
+			t.Errorf("ResolveArchiveMember(%q) = %q, %q, %q; want %q, %q, %q",
+				tc.column, b.DataSetPath, b.ColumnPath, b.Table, tc.dataset, tc.rest, tc.table)
+		}
+	}
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{
+		DefaultDataDir: filepath.Join(tempDir, "pb_data"),
+	})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap PocketBase: %v", err)
+	}
+	defer app.ResetBootstrapState()
+
+	if err := flight.EnsureCollections(app); err != nil {
+		t.Fatalf("Failed to ensure collections: %v", err)
+	}
+	settings, _ := app.FindCollectionByNameOrId("app_settings")
+	setting := core.NewRecord(settings)
+	setting.Load(map[string]any{"key": "serve_folder", "value": serveDir})
+	if err := app.Save(setting); err != nil {
+		t.Fatalf("Failed to save serve_folder: %v", err)
+	}
+
+	pipelines, _ := app.FindCollectionByNameOrId("data_pipelines")
+	for name, rclonePath := range map[string]string{"sales": "export.zip/inner/sales.csv", "inner": "export.zip/inner", "data": "export.zip/v1.2/data.csv", "dotted": "export.zip/v1.2/tb0"} {
+		pipeline := core.NewRecord(pipelines)
+		pipeline.Load(map[string]any{"name": name, "rclone_path": rclonePath})
+		if err := app.Save(pipeline); err != nil {
+			t.Fatalf("Failed to save pipeline: %v", err)
+		}
+		if err := flight.RunPipeline(app, pipeline); err != nil {
+			t.Fatalf("RunPipeline(%s) failed: %v", rclonePath, err)
+		}
+	}
+
+	// 1. The member converts on its own
+	_, salesCache, err := flight.CacheURLLocation(app, "/export.zip/inner/sales.csv")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v", err)
+	}
+	if n := countRows(t, salesCache, "SELECT COUNT(*) FROM tb0"); n != 2 {
+		t.Errorf("Expected 2 rows from the member, got %d", n)
+	}
+
+	// 1b. Also below a folder with a dot in its name
+	_, dataCache, err := flight.CacheURLLocation(app, "/export.zip/v1.2/data.csv")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v", err)
+	}
+	if n := countRows(t, dataCache, "SELECT COUNT(*) FROM tb0"); n != 3 {
+		t.Errorf("Expected 3 rows from the member of the dotted folder, got %d", n)
+	}
+
+	// 1c. A table after a dotted folder warms the folder listing a request serves
+	_, dottedCache, err := flight.CacheURLLocation(app, "/export.zip/v1.2/tb0")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v", err)
+	}
+	if n := countRows(t, dottedCache, "SELECT COUNT(*) FROM tb0"); n != 1 {
+		t.Errorf("Expected data.csv in the dotted folder listing, got %d rows", n)
+	}
+
+	// 2. A folder inside the archive lists its direct children
+	_, innerCache, err := flight.CacheURLLocation(app, "/export.zip/inner")
+	if err != nil {
+		t.Fatalf("CacheURLLocation: %v", err)
+	}
+	if n := countRows(t, innerCache, "SELECT COUNT(*) FROM tb0"); n != 2 {
+		t.Errorf("Expected sales.csv and 2026 in the folder listing, got %d rows", n)
+	}
+	if n := countRows(t, innerCache, "SELECT COUNT(*) FROM tb0 WHERE name = '2026' AND is_dir = '1'"); n != 1 {
+		t.Error("Expected the implicit 2026 folder to be listed as a directory")
+	}
+}